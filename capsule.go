@@ -0,0 +1,209 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"siteserver/content"
+	"siteserver/gemini"
+	"siteserver/gemtext"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// capsuleStore is what the capsule reads from the database.
+type capsuleStore interface {
+	GetGemlog(limit int) ([]content.Thumbnail, error)
+	GetPostContent(link string) (content.Post, error)
+	GetPapers() ([]content.Thumbnail, error)
+}
+
+type poolStore struct{ pool *pgxpool.Pool }
+
+func (s poolStore) GetGemlog(limit int) ([]content.Thumbnail, error) {
+	return content.GetGemlog(s.pool, limit)
+}
+
+func (s poolStore) GetPostContent(link string) (content.Post, error) {
+	return content.GetPostContent(s.pool, link)
+}
+
+func (s poolStore) GetPapers() ([]content.Thumbnail, error) {
+	return content.GetPapers(s.pool)
+}
+
+// newCapsule serves the site over Gemini: the same posts and papers as the
+// web site, as gemtext.
+func newCapsule(db capsuleStore, bodies content.Source, siteURL string) *gemini.ServeMux {
+	mux := gemini.NewServeMux()
+
+	mux.HandleFunc("/", func(w gemini.ResponseWriter, r *gemini.Request) {
+		if r.URL.Path != "/" {
+			gemini.NotFound(w)
+			return
+		}
+		recent, err := db.GetGemlog(4)
+		if err != nil {
+			log.Printf("[gemini] content.GetGemlog: %v", err)
+		}
+		doc := gemtext.Document{
+			{Kind: gemtext.Heading1, Text: "Alex Shroyer"},
+			{Kind: gemtext.Text, Text: "research and hobbies of a computer engineer"},
+			{Kind: gemtext.Text},
+			{Kind: gemtext.Heading2, Text: "Recent posts"},
+		}
+		doc = append(doc, logLinks(recent)...)
+		doc = append(doc,
+			gemtext.Line{Kind: gemtext.Text},
+			gemtext.Line{Kind: gemtext.Link, URL: "/posts/", Text: "All posts"},
+			gemtext.Line{Kind: gemtext.Link, URL: "/papers/", Text: "Publications"},
+			gemtext.Line{Kind: gemtext.Link, URL: "/gemlog.gmi", Text: "Gemlog feed"},
+			gemtext.Line{Kind: gemtext.Link, URL: siteURL, Text: "The web version of this site"},
+		)
+		fmt.Fprint(w, doc)
+	})
+
+	mux.HandleFunc("/gemlog.gmi", func(w gemini.ResponseWriter, r *gemini.Request) {
+		posts, err := db.GetGemlog(0)
+		if err != nil {
+			log.Printf("[gemini] content.GetGemlog: %v", err)
+			w.WriteHeader(gemini.StatusTemporaryFailure, "Try again later")
+			return
+		}
+		// the subscription format: a title, then one dated link per post
+		doc := gemtext.Document{
+			{Kind: gemtext.Heading1, Text: "Alex Shroyer"},
+			{Kind: gemtext.Heading2, Text: "research and hobbies of a computer engineer"},
+			{Kind: gemtext.Text},
+		}
+		fmt.Fprint(w, append(doc, logLinks(posts)...))
+	})
+
+	mux.HandleFunc("/posts/", func(w gemini.ResponseWriter, r *gemini.Request) {
+		link := strings.TrimPrefix(r.URL.Path, "/posts/")
+		if link == "" {
+			posts, err := db.GetGemlog(0)
+			if err != nil {
+				log.Printf("[gemini] content.GetGemlog: %v", err)
+				w.WriteHeader(gemini.StatusTemporaryFailure, "Try again later")
+				return
+			}
+			doc := gemtext.Document{{Kind: gemtext.Heading1, Text: "All Posts"}}
+			for _, p := range posts {
+				doc = append(doc,
+					gemtext.Line{Kind: gemtext.Text},
+					gemtext.Line{Kind: gemtext.Link, URL: "/posts/" + p.Link, Text: p.Date + " " + oneLine(p.Title)},
+					gemtext.Line{Kind: gemtext.Text, Text: oneLine(p.Summary)},
+				)
+			}
+			fmt.Fprint(w, doc)
+			return
+		}
+
+		post, err := db.GetPostContent(link)
+		if errors.Is(err, pgx.ErrNoRows) || (err == nil && !post.Visible("")) {
+			gemini.NotFound(w)
+			return
+		}
+		if err != nil {
+			log.Printf("[gemini] content.GetPostContent: %v", err)
+			w.WriteHeader(gemini.StatusTemporaryFailure, "Try again later")
+			return
+		}
+		body, err := bodies.Body(link)
+		if err != nil && !errors.Is(err, content.ErrNoBody) {
+			log.Printf("[gemini] %s: %v", link, err)
+		}
+		text, err := postGemtext(body, siteURL+"/posts/"+link)
+		if err != nil {
+			log.Printf("[gemini] %s: %v", link, err)
+		}
+		// the byline goes under the post's own title, or one made for it
+		doc := gemtext.Document{{Kind: gemtext.Heading1, Text: oneLine(post.Title)}}
+		if len(text) > 0 && text[0].Kind == gemtext.Heading1 {
+			doc[0], text = text[0], text[1:]
+		}
+		for len(text) > 0 && text[0].Kind == gemtext.Text && text[0].Text == "" {
+			text = text[1:]
+		}
+		doc = append(doc, gemtext.Line{Kind: gemtext.Text, Text: "by " + post.Author})
+		doc = append(doc, gemtext.Line{Kind: gemtext.Text})
+		doc = append(doc, text...)
+		doc = append(doc,
+			gemtext.Line{Kind: gemtext.Text},
+			gemtext.Line{Kind: gemtext.Link, URL: siteURL + "/posts/" + link, Text: "Read this on the web, with comments"},
+			gemtext.Line{Kind: gemtext.Link, URL: "/posts/", Text: "All posts"},
+		)
+		fmt.Fprint(w, doc)
+	})
+
+	mux.HandleFunc("/papers/", func(w gemini.ResponseWriter, r *gemini.Request) {
+		file := strings.TrimPrefix(r.URL.Path, "/papers/")
+		if file != "" {
+			if strings.ContainsAny(file, `/\`) || strings.HasPrefix(file, ".") {
+				gemini.NotFound(w)
+				return
+			}
+			pdf, err := os.ReadFile(filepath.Join("./static/papers", file))
+			if err != nil {
+				gemini.NotFound(w)
+				return
+			}
+			w.WriteHeader(gemini.StatusSuccess, "application/pdf")
+			w.Write(pdf)
+			return
+		}
+		papers, err := db.GetPapers()
+		if err != nil {
+			log.Printf("[gemini] content.GetPapers: %v", err)
+			w.WriteHeader(gemini.StatusTemporaryFailure, "Try again later")
+			return
+		}
+		doc := gemtext.Document{{Kind: gemtext.Heading1, Text: "Publications"}}
+		for _, p := range papers {
+			doc = append(doc,
+				gemtext.Line{Kind: gemtext.Text},
+				gemtext.Line{Kind: gemtext.Link, URL: "/papers/" + p.Link, Text: oneLine(p.Title)},
+				gemtext.Line{Kind: gemtext.Text, Text: p.Date},
+				gemtext.Line{Kind: gemtext.Quote, Text: oneLine(p.Summary)},
+			)
+		}
+		fmt.Fprint(w, doc)
+	})
+
+	return mux
+}
+
+// oneLine collapses text from the database onto a single line, so that a
+// line break in it can't start a link or heading of its own.
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func logLinks(posts []content.Thumbnail) gemtext.Document {
+	var doc gemtext.Document
+	for _, p := range posts {
+		doc = append(doc, gemtext.Line{Kind: gemtext.Link, URL: "/posts/" + p.Link, Text: p.Date + " " + oneLine(p.Title)})
+	}
+	return doc
+}
+
+// postGemtext turns a post body into gemtext. Posts written in gemtext are
+// served as they are; anything else is converted from its HTML, with relative
+// links pointing at the web site.
+func postGemtext(body content.Body, webURL string) (gemtext.Document, error) {
+	if body.Format == "gmi" {
+		return gemtext.Parse(body.Text), nil
+	}
+	base, err := url.Parse(webURL)
+	if err != nil {
+		return nil, err
+	}
+	return gemtext.FromHTML(strings.NewReader(string(body.HTML())), base)
+}
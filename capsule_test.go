@@ -0,0 +1,213 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"siteserver/content"
+	"siteserver/gemini"
+	"siteserver/gemtext"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// fakeStore stands in for the database.
+type fakeStore struct {
+	posts  []content.Thumbnail // published, newest first
+	post   map[string]content.Post
+	papers []content.Thumbnail
+	err    error
+}
+
+func (s fakeStore) GetGemlog(limit int) ([]content.Thumbnail, error) {
+	if limit > 0 && limit < len(s.posts) {
+		return s.posts[:limit], s.err
+	}
+	return s.posts, s.err
+}
+
+func (s fakeStore) GetPostContent(link string) (content.Post, error) {
+	if s.err != nil {
+		return content.Post{}, s.err
+	}
+	p, ok := s.post[link]
+	if !ok {
+		return content.Post{}, pgx.ErrNoRows
+	}
+	return p, nil
+}
+
+func (s fakeStore) GetPapers() ([]content.Thumbnail, error) {
+	return s.papers, s.err
+}
+
+type fakeBodies map[string]content.Body
+
+func (b fakeBodies) Body(link string) (content.Body, error) {
+	body, ok := b[link]
+	if !ok {
+		return content.Body{}, content.ErrNoBody
+	}
+	return body, nil
+}
+
+// startCapsule serves the capsule on a loopback port and returns its address.
+func startCapsule(t *testing.T, db capsuleStore, bodies content.Source) string {
+	t.Helper()
+	cert, err := gemini.LoadCertificate("", "", "localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &gemini.Server{Hostname: "localhost", Handler: newCapsule(db, bodies, "https://alexshroyer.com")}
+	go s.Serve(ln)
+	t.Cleanup(func() { ln.Close() })
+	return ln.Addr().String()
+}
+
+// gemFetch requests path from the capsule at addr.
+func gemFetch(t *testing.T, addr, path string) (header, body string) {
+	t.Helper()
+	conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := io.WriteString(conn, "gemini://localhost"+path+"\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, body, _ = strings.Cut(string(resp), "\r\n")
+	return header, body
+}
+
+const gemOK = "20 text/gemini; charset=utf-8"
+
+var capsuleData = fakeStore{
+	posts: []content.Thumbnail{
+		{Link: "floatver", Title: "FloatVer", Summary: "A versioning scheme.\n=> https://evil.example Click", Date: "2024-07-03", Status: "published"},
+		{Link: "notes", Title: "Notes\n# Not a heading", Summary: "Written in gemtext.", Date: "2024-06-01", Status: "published"},
+	},
+	post: map[string]content.Post{
+		"floatver": {Link: "floatver", Title: "FloatVer", Author: "alex", Status: "published"},
+		"notes":    {Link: "notes", Title: "Notes", Author: "alex", Status: "published"},
+		"secret":   {Link: "secret", Title: "Secret", Author: "alex", Status: "unlisted"},
+		"wip":      {Link: "wip", Title: "WIP", Author: "alex", Status: "draft"},
+	},
+	papers: []content.Thumbnail{
+		{Link: "aisc2022.pdf", Title: "An Array Paper", Summary: "We study arrays.\n\n* and lists", Date: "March 2022", Status: "published"},
+	},
+}
+
+var capsuleBodies = fakeBodies{
+	"floatver": {Format: "html", Text: []byte(`<h1>FloatVer</h1><p>See <a href="/posts/notes">my notes</a>.</p>`)},
+	"notes":    {Format: "gmi", Text: []byte("# Notes\n=> gemini://example.org/ A capsule\n")},
+	"secret":   {Format: "html", Text: []byte(`<p>Only with the link.</p>`)},
+	"wip":      {Format: "html", Text: []byte(`<p>Not yet.</p>`)},
+}
+
+func TestCapsuleGemlog(t *testing.T) {
+	addr := startCapsule(t, capsuleData, capsuleBodies)
+	header, body := gemFetch(t, addr, "/gemlog.gmi")
+	want := "# Alex Shroyer\n## research and hobbies of a computer engineer\n\n" +
+		"=> /posts/floatver 2024-07-03 FloatVer\n" +
+		"=> /posts/notes 2024-06-01 Notes # Not a heading\n"
+	if header != gemOK || body != want {
+		t.Errorf("gemlog: got %q\n%s\nwant %q\n%s", header, body, gemOK, want)
+	}
+
+	_, body = gemFetch(t, addr, "/")
+	doc := gemtext.Parse([]byte(body))
+	var links []string
+	for _, l := range doc {
+		if l.Kind == gemtext.Link {
+			links = append(links, l.URL)
+		}
+	}
+	if got := strings.Join(links, " "); got != "/posts/floatver /posts/notes /posts/ /papers/ /gemlog.gmi https://alexshroyer.com" {
+		t.Errorf("home page links = %s", got)
+	}
+}
+
+func TestCapsulePosts(t *testing.T) {
+	addr := startCapsule(t, capsuleData, capsuleBodies)
+
+	header, body := gemFetch(t, addr, "/posts/")
+	if header != gemOK {
+		t.Fatalf("/posts/: %q", header)
+	}
+	for _, l := range gemtext.Parse([]byte(body)) {
+		if l.Kind == gemtext.Link && strings.Contains(l.URL, "evil") {
+			t.Errorf("a summary's line break made a link: %+v", l)
+		}
+		if l.Kind == gemtext.Heading1 && l.Text != "All Posts" {
+			t.Errorf("a title's line break made a heading: %+v", l)
+		}
+	}
+	if !strings.Contains(body, "\nA versioning scheme. => https://evil.example Click\n") {
+		t.Errorf("/posts/ summary wasn't kept on one line:\n%s", body)
+	}
+
+	header, body = gemFetch(t, addr, "/posts/floatver")
+	want := "# FloatVer\nby alex\n\nSee my notes.\n=> https://alexshroyer.com/posts/notes my notes\n\n" +
+		"=> https://alexshroyer.com/posts/floatver Read this on the web, with comments\n=> /posts/ All posts\n"
+	if header != gemOK || body != want {
+		t.Errorf("HTML post: got %q\n%s\nwant\n%s", header, body, want)
+	}
+
+	_, body = gemFetch(t, addr, "/posts/notes")
+	if !strings.HasPrefix(body, "# Notes\nby alex\n\n=> gemini://example.org/ A capsule\n") {
+		t.Errorf("gemtext post wasn't served as written:\n%s", body)
+	}
+
+	if header, _ := gemFetch(t, addr, "/posts/secret"); header != gemOK {
+		t.Errorf("unlisted post: %q, want it served to whoever has the link", header)
+	}
+	for _, path := range []string{"/posts/wip", "/posts/missing"} {
+		if header, _ := gemFetch(t, addr, path); header != "51 Not found" {
+			t.Errorf("%s: %q, want 51", path, header)
+		}
+	}
+}
+
+func TestCapsulePapers(t *testing.T) {
+	addr := startCapsule(t, capsuleData, capsuleBodies)
+
+	header, body := gemFetch(t, addr, "/papers/")
+	want := "# Publications\n\n=> /papers/aisc2022.pdf An Array Paper\nMarch 2022\n> We study arrays. * and lists\n"
+	if header != gemOK || body != want {
+		t.Errorf("/papers/: got %q\n%s\nwant\n%s", header, body, want)
+	}
+
+	header, body = gemFetch(t, addr, "/papers/aisc2022.pdf")
+	if header != "20 application/pdf" || !strings.HasPrefix(body, "%PDF") {
+		t.Errorf("paper: got %q and %.8q, want a PDF", header, body)
+	}
+	for _, path := range []string{"/papers/missing.pdf", "/papers/.hidden", "/papers/..%2fcapsule.go"} {
+		if header, _ := gemFetch(t, addr, path); header != "51 Not found" {
+			t.Errorf("%s: %q, want 51", path, header)
+		}
+	}
+}
+
+func TestCapsuleDatabaseDown(t *testing.T) {
+	addr := startCapsule(t, fakeStore{err: errors.New("connection refused")}, capsuleBodies)
+	for _, path := range []string{"/gemlog.gmi", "/posts/", "/posts/floatver", "/papers/"} {
+		if header, _ := gemFetch(t, addr, path); header != "40 Try again later" {
+			t.Errorf("%s: %q, want 40", path, header)
+		}
+	}
+	// the home page still works, just without recent posts
+	if header, _ := gemFetch(t, addr, "/"); header != gemOK {
+		t.Errorf("home page: %q", header)
+	}
+}
@@ -1,4 +1,18 @@
 -- Drop tables in reverse order of creation to avoid foreign key constraint issues
+DROP TABLE IF EXISTS sanctions;
+DROP TABLE IF EXISTS reports;
+DROP TABLE IF EXISTS notifications;
+DROP TABLE IF EXISTS webmentions;
+DROP TABLE IF EXISTS notification_prefs;
+DROP TABLE IF EXISTS mentions;
+DROP TABLE IF EXISTS reactions;
 DROP TABLE IF EXISTS comments;
+DROP TABLE IF EXISTS related_posts;
+DROP TABLE IF EXISTS series_posts;
+DROP TABLE IF EXISTS series;
+DROP TABLE IF EXISTS post_tags;
+DROP TABLE IF EXISTS tags;
+DROP TABLE IF EXISTS papers;
+DROP TABLE IF EXISTS revisions;
 DROP TABLE IF EXISTS posts;
 DROP TABLE IF EXISTS users;
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/url"
+	"os"
+
+	"siteserver/notify"
+)
+
+// Config is read once at startup from the environment.
+type Config struct {
+	SiteURL       string // public address, used in emails and feeds
+	SiteImage     string // preview image for shared links to pages without their own
+	GuestComments bool   // let logged-out readers comment (held for moderation)
+	Mail          notify.Mailer
+	Gemini        GeminiConfig
+}
+
+// GeminiConfig sets up the Gemini capsule. It is off unless Addr is set,
+// e.g. GEMINI_ADDR=:1965.
+type GeminiConfig struct {
+	Addr     string
+	Hostname string
+	CertFile string // created, self-signed, if it doesn't exist
+	KeyFile  string
+}
+
+func getenv(key, fallback string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		return v
+	}
+	return fallback
+}
+
+func loadConfig() Config {
+	siteURL := getenv("SITE_URL", "https://alexshroyer.com")
+	host := ""
+	if u, err := url.Parse(siteURL); err == nil {
+		host = u.Hostname()
+	}
+	return Config{
+		SiteURL:       siteURL,
+		SiteImage:     getenv("SITE_IMAGE", "/images/pfp.png"),
+		GuestComments: getenv("GUEST_COMMENTS", "") == "true",
+		Mail: notify.Mailer{
+			Addr:     getenv("SMTP_ADDR", "smtp.gmail.com:587"),
+			User:     os.Getenv("SMTP_USER"),
+			Password: os.Getenv("APP_PASSWORD"),
+			From:     getenv("MAIL_FROM", "contact@alexshroyer.com"),
+		},
+		Gemini: GeminiConfig{
+			Addr:     os.Getenv("GEMINI_ADDR"),
+			Hostname: getenv("GEMINI_HOSTNAME", host),
+			CertFile: getenv("GEMINI_CERT", "gemini.crt"),
+			KeyFile:  getenv("GEMINI_KEY", "gemini.key"),
+		},
+	}
+}
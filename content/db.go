@@ -2,27 +2,61 @@ package content
 
 import (
 	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"siteserver/rewrite"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// Conn is a pool, or a transaction for a function to be part of. A function
+// that begins its own transaction on one nests it as a savepoint.
+type Conn interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
 type Comment struct {
-	Username string `db:"username"`
-	When     string `db:"when"`
-	Content  string `db:"content"`
+	ID        int       `db:"id"`
+	Username  string    `db:"username"` // the guest's chosen name for guest comments
+	Guest     bool      `db:"guest"`
+	When      string    `db:"when"`
+	Content   string    `db:"content"`
+	Mentions  []string  `db:"mentions"` // usernames that were @mentioned and exist
+	Reactions Reactions `db:"-"`
 }
 
 type Post struct {
-	ID       int       `db:"id"`
-	Link     string    `db:"link"`
-	Title    string    `db:"title"`
-	Summary  string    `db:"summary"`
-	Author   string    `db:"author"`
-	Content  any       `db:"-"`
-	Date     string    `db:"date"`
-	Comments []Comment `db:"-"`
-	Profile  string    `db:"-"`
+	ID          int               `db:"id"`
+	Link        string            `db:"link"`
+	Title       string            `db:"title"`
+	Summary     string            `db:"summary"`
+	Author      string            `db:"author"`
+	Status      string            `db:"status"` // draft, scheduled, published or unlisted
+	Content     any               `db:"-"`
+	Date        string            `db:"date"`
+	Image       string            `db:"image"` // preview image for shared links, if the post has chosen one
+	Published   time.Time         `db:"published_at"`
+	Updated     time.Time         `db:"updated_at"`
+	Tags        []string          `db:"-"`
+	Series      *Series           `db:"-"`
+	Related     []Thumbnail       `db:"-"` // posts to read next
+	TOC         []rewrite.Heading `db:"-"`
+	Words       int               `db:"-"`
+	Minutes     int               `db:"-"` // reading time
+	Comments    []Comment         `db:"-"`
+	Webmentions []Webmention      `db:"-"`
+	Reactions   Reactions         `db:"-"`
+	Profile     string            `db:"-"`
+	Guests      bool              `db:"-"` // show the guest comment form to logged-out readers
+	Editable    bool              `db:"-"` // the viewer may open it in the editor
+	Meta        *Meta             `db:"-"`
 }
 
 type Thumbnail struct {
@@ -30,22 +64,25 @@ type Thumbnail struct {
 	Title   string `db:"title"`
 	Summary string `db:"summary"`
 	Date    string `db:"date"`
+	Status  string `db:"status"`
 }
 
 func New() (*pgxpool.Pool, error) {
 	return pgxpool.New(context.Background(), "postgres://postgres@localhost:5432/mysite")
 }
 
+// Listings show published posts newest first, breaking ties by id so that
+// pages don't overlap.
+const thumbnailOrder = `ORDER BY published_at DESC, id DESC`
+
 func GetThumbnails(pool *pgxpool.Pool, limit int) ([]Thumbnail, error) {
-	var rows pgx.Rows
-	var err error
+	query := `SELECT link, title, summary, time_format(published_at) AS date, status FROM posts WHERE status = 'published' AND published_at <= now() ` + thumbnailOrder
+	args := []any{}
 	if limit > 0 {
-		query := `SELECT link, title, summary, time_format(updated_at) AS date FROM posts ORDER BY updated_at DESC LIMIT $1`
-		rows, err = pool.Query(context.Background(), query, limit)
-	} else {
-		query := `SELECT link, title, summary, time_format(updated_at) AS date FROM posts ORDER BY created_at DESC`
-		rows, err = pool.Query(context.Background(), query)
+		query += ` LIMIT $1`
+		args = append(args, limit)
 	}
+	rows, err := pool.Query(context.Background(), query, args...)
 	if err != nil {
 		return []Thumbnail{}, err
 	}
@@ -53,9 +90,89 @@ func GetThumbnails(pool *pgxpool.Pool, limit int) ([]Thumbnail, error) {
 	return pgx.CollectRows(rows, pgx.RowToStructByName[Thumbnail])
 }
 
+var ErrBadCursor = errors.New("content: bad page cursor")
+
+// GetThumbnailPage returns up to limit published posts, starting after
+// cursor (or from the newest, if cursor is empty), along with the cursor for
+// the page after this one. The next cursor is empty on the last page.
+func GetThumbnailPage(pool *pgxpool.Pool, cursor string, limit int) ([]Thumbnail, string, error) {
+	// a cursor is the last post's published_at in microseconds, and its id
+	var micros, id int64
+	if cursor != "" {
+		before, after, ok := strings.Cut(cursor, "-")
+		var err1, err2 error
+		micros, err1 = strconv.ParseInt(before, 10, 64)
+		id, err2 = strconv.ParseInt(after, 10, 64)
+		if !ok || err1 != nil || err2 != nil {
+			return nil, "", ErrBadCursor
+		}
+	}
+	query := `
+SELECT link, title, summary, time_format(published_at) AS date, status,
+(extract(epoch FROM published_at) * 1000000)::bigint || '-' || id AS cursor
+FROM posts
+WHERE status = 'published' AND published_at <= now()
+AND ($1 = '' OR (published_at, id) < ($2, $3))
+` + thumbnailOrder + `
+LIMIT $4`
+	rows, err := pool.Query(context.Background(), query, cursor, time.UnixMicro(micros), id, limit+1)
+	if err != nil {
+		return []Thumbnail{}, "", err
+	}
+	defer rows.Close()
+	page, err := pgx.CollectRows(rows, pgx.RowToStructByName[struct {
+		Thumbnail
+		Cursor string `db:"cursor"`
+	}])
+	if err != nil {
+		return []Thumbnail{}, "", err
+	}
+	next := ""
+	if len(page) > limit {
+		page = page[:limit]
+		next = page[limit-1].Cursor
+	}
+	thumbs := make([]Thumbnail, len(page))
+	for i, p := range page {
+		thumbs[i] = p.Thumbnail
+	}
+	return thumbs, next, nil
+}
+
+// GetDrafts lists an author's posts that aren't public yet.
+func GetDrafts(pool *pgxpool.Pool, author string) ([]Thumbnail, error) {
+	query := `
+SELECT link, title, summary, time_format(updated_at) AS date, status
+FROM posts p
+JOIN users u ON p.author_id = u.id
+WHERE u.username = $1 AND status IN ('draft', 'scheduled')
+ORDER BY updated_at DESC`
+	rows, err := pool.Query(context.Background(), query, author)
+	if err != nil {
+		return []Thumbnail{}, err
+	}
+	defer rows.Close()
+	return pgx.CollectRows(rows, pgx.RowToStructByName[Thumbnail])
+}
+
+// PublishScheduled publishes every scheduled post whose time has come.
+func PublishScheduled(pool *pgxpool.Pool) (int64, error) {
+	query := `UPDATE posts SET status = 'published' WHERE status = 'scheduled' AND published_at <= now()`
+	tag, err := pool.Exec(context.Background(), query)
+	return tag.RowsAffected(), err
+}
+
+// Visible says whether viewer may read the post. Drafts and scheduled posts
+// are only visible to their author; unlisted ones to anyone with the link.
+func (p Post) Visible(viewer string) bool {
+	return p.Status == "published" || p.Status == "unlisted" || (viewer != "" && viewer == p.Author)
+}
+
 func GetPostContent(pool *pgxpool.Pool, link string) (Post, error) {
 	query := `
-SELECT p.id, link, title, summary, u.username AS author, time_format(updated_at) as date
+SELECT p.id, link, title, summary, u.username AS author, p.status, time_format(updated_at) as date,
+COALESCE(p.image, '') AS image, COALESCE(p.published_at, p.created_at) AS published_at,
+COALESCE(p.updated_at, p.created_at) AS updated_at
 FROM posts p
 JOIN users u ON p.author_id = u.id
 WHERE p.link = $1`
@@ -67,15 +184,19 @@ WHERE p.link = $1`
 	return pgx.CollectOneRow(rows, pgx.RowToStructByName[Post])
 }
 
-func GetComments(pool *pgxpool.Pool, postID int) ([]Comment, error) {
+// GetComments returns a post's visible comments. Comments from shadowbanned
+// users are included only when viewer wrote them.
+func GetComments(pool *pgxpool.Pool, postID int, viewer string) ([]Comment, error) {
 	// SELECT u.username, time_format(c.created_at) AS when, c.content
 	query := `
-SELECT u.username, time_format(c.created_at) AS when, c.content
+SELECT c.id, COALESCE(u.username, c.guest_name) AS username, c.user_id IS NULL AS guest,
+time_format(c.created_at) AS when, c.content,
+ARRAY(SELECT mu.username FROM mentions m JOIN users mu ON m.user_id = mu.id WHERE m.comment_id = c.id) AS mentions
 FROM comments c
-JOIN users u ON c.user_id = u.id
-WHERE c.post_id = $1
+LEFT JOIN users u ON c.user_id = u.id
+WHERE c.post_id = $1 AND (c.status = 'approved' OR (c.status = 'shadow' AND u.username = $2))
 ORDER BY c.created_at ASC`
-	rows, err := pool.Query(context.Background(), query, postID)
+	rows, err := pool.Query(context.Background(), query, postID, viewer)
 	if err != nil {
 		return []Comment{}, err
 	}
@@ -87,18 +208,50 @@ ORDER BY c.created_at ASC`
 	return comments, err
 }
 
-func PostComment(pool *pgxpool.Pool, postID int, userID string, content string) ([]Comment, error) {
+// PostComment adds a comment. A hidden comment is stored as a shadow comment,
+// which only its author will ever see.
+func PostComment(pool *pgxpool.Pool, postID int, userID string, content string, hidden bool) ([]Comment, error) {
+	status := "approved"
+	if hidden {
+		status = "shadow"
+	}
 	query := `
 WITH rows AS
-(INSERT INTO comments (post_id, user_id, content) VALUES
- ($1, (SELECT id FROM users WHERE username = $2), $3) RETURNING *)
-SELECT u.username, time_format(c.created_at) AS when, c.content
+(INSERT INTO comments (post_id, user_id, content, status) VALUES
+ ($1, (SELECT id FROM users WHERE username = $2), $3, $4) RETURNING *)
+SELECT c.id, u.username, false AS guest, time_format(c.created_at) AS when, c.content,
+ARRAY[]::text[] AS mentions -- filled in by SaveMentions
 FROM rows c JOIN users u ON
 c.user_id = u.id`
-	rows, err := pool.Query(context.Background(), query, postID, userID, content)
+	rows, err := pool.Query(context.Background(), query, postID, userID, content, status)
 	defer rows.Close()
 	if err != nil {
 		return []Comment{}, err
 	}
-	return pgx.CollectRows(rows, pgx.RowToStructByName[Comment])
+	comments, err := pgx.CollectRows(rows, pgx.RowToStructByName[Comment])
+	for i := range comments {
+		comments[i].Reactions = NewReactions("comment", comments[i].ID)
+	}
+	return comments, err
+}
+
+// GetUserComments lists a user's most recent approved comments for their
+// profile page: those on listed posts, and on the viewer's own posts.
+func GetUserComments(pool *pgxpool.Pool, username, viewer string, limit int) ([]FeedComment, error) {
+	query := `
+SELECT c.id, p.link AS post_link, p.title AS post_title, u.username, c.content, c.created_at
+FROM comments c
+JOIN posts p ON c.post_id = p.id
+JOIN users a ON p.author_id = a.id
+JOIN users u ON c.user_id = u.id
+WHERE u.username = $1 AND c.status = 'approved'
+AND ((p.status = 'published' AND p.published_at <= now()) OR a.username = $3)
+ORDER BY c.created_at DESC
+LIMIT $2`
+	rows, err := pool.Query(context.Background(), query, username, limit, viewer)
+	if err != nil {
+		return []FeedComment{}, err
+	}
+	defer rows.Close()
+	return pgx.CollectRows(rows, pgx.RowToStructByName[FeedComment])
 }
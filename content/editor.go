@@ -0,0 +1,149 @@
+package content
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Draft is a post as the editor sees it.
+type Draft struct {
+	ID        int        `db:"id"` // 0 for a post that hasn't been saved yet
+	Link      string     `db:"link"`
+	Title     string     `db:"title"`
+	Summary   string     `db:"summary"`
+	Author    string     `db:"author"`
+	Status    string     `db:"status"`
+	PublishAt *time.Time `db:"published_at"`
+	Series    string     `db:"series"` // title of the series it's part of, if any
+	Image     string     `db:"image"`  // preview image for shared links
+	Body      string     `db:"-"`
+}
+
+var validLink = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+var validImage = regexp.MustCompile(`^(/[^/\s]|https?://)\S*$`)
+
+var statuses = map[string]bool{"draft": true, "scheduled": true, "published": true, "unlisted": true}
+
+// Problem says what's wrong with a draft, or "" if it can be saved.
+func (d Draft) Problem() string {
+	switch {
+	case d.Title == "" || len(d.Title) > 255:
+		return "The title should be 1-255 characters."
+	case len(d.Link) > 75 || !validLink.MatchString(d.Link):
+		return "The link should be up to 75 lowercase letters, digits and dashes."
+	case d.Summary == "":
+		return "Please write a summary."
+	case len(d.Series) > 255:
+		return "The series name is too long."
+	case d.Image != "" && !validImage.MatchString(d.Image):
+		return "The preview image should be a path like /images/x.png or an https:// URL."
+	case !statuses[d.Status]:
+		return "Unknown status."
+	case d.Status == "scheduled" && (d.PublishAt == nil || d.PublishAt.Before(time.Now())):
+		return "Scheduled posts need a publish time in the future."
+	case d.Status == "published" && d.PublishAt != nil && d.PublishAt.After(time.Now()):
+		return "Posts that go live later should be scheduled, not published."
+	}
+	return ""
+}
+
+// PublishAtInput formats PublishAt for a datetime-local input.
+func (d Draft) PublishAtInput() string {
+	if d.PublishAt == nil {
+		return ""
+	}
+	return d.PublishAt.UTC().Format("2006-01-02T15:04")
+}
+
+func GetDraft(pool *pgxpool.Pool, link string) (Draft, error) {
+	query := `
+SELECT p.id, link, p.title, p.summary, u.username AS author, p.status,
+CASE WHEN p.status <> 'draft' THEN published_at END AS published_at, -- drafts go live when first published
+COALESCE(s.title, '') AS series,
+COALESCE(p.image, '') AS image
+FROM posts p
+JOIN users u ON p.author_id = u.id
+LEFT JOIN series_posts sp ON sp.post_id = p.id
+LEFT JOIN series s ON sp.series_id = s.id
+WHERE p.link = $1`
+	rows, err := pool.Query(context.Background(), query, link)
+	if err != nil {
+		return Draft{}, err
+	}
+	defer rows.Close()
+	return pgx.CollectOneRow(rows, pgx.RowToStructByName[Draft])
+}
+
+// GetPostLink returns the link a post is saved under.
+func GetPostLink(pool *pgxpool.Pool, id int) (string, error) {
+	var link string
+	err := pool.QueryRow(context.Background(), `SELECT link FROM posts WHERE id = $1`, id).Scan(&link)
+	return link, err
+}
+
+// PostTaken says whether another post already uses the link or title.
+func PostTaken(pool *pgxpool.Pool, d Draft) (bool, error) {
+	var taken bool
+	query := `SELECT EXISTS (SELECT 1 FROM posts WHERE (link = $1 OR title = $2) AND id <> $3)`
+	err := pool.QueryRow(context.Background(), query, d.Link, d.Title, d.ID).Scan(&taken)
+	return taken, err
+}
+
+// SavePost creates or updates a post from the editor, storing the body in the
+// database and recording it as a revision, all or nothing. New posts get their
+// ID filled in. Joining a series puts the post last in it.
+func SavePost(pool *pgxpool.Pool, d *Draft, author string) error {
+	ctx := context.Background()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	id := d.ID
+	if id == 0 {
+		query := `
+INSERT INTO posts (link, title, author_id, summary, content, body_text, status, published_at, image)
+VALUES ($1, $2, (SELECT id FROM users WHERE username = $3), $4, $5, $6, $7, COALESCE($8, CURRENT_TIMESTAMP), NULLIF($9, ''))
+RETURNING id`
+		err := tx.QueryRow(ctx, query, d.Link, d.Title, author, d.Summary, d.Body, PlainText(d.Body), d.Status, d.PublishAt, d.Image).Scan(&id)
+		if err != nil {
+			return err
+		}
+	} else {
+		// publishing a draft for the first time makes it new as of now
+		query := `
+UPDATE posts SET link = $2, title = $3, summary = $4, content = $5, body_text = $6, status = $7,
+image = NULLIF($9, ''),
+published_at = CASE WHEN $8::timestamptz IS NOT NULL THEN $8
+                    WHEN status = 'draft' AND $7 <> 'draft' THEN CURRENT_TIMESTAMP
+                    ELSE published_at END
+WHERE id = $1`
+		_, err := tx.Exec(ctx, query, id, d.Link, d.Title, d.Summary, d.Body, PlainText(d.Body), d.Status, d.PublishAt, d.Image)
+		if err != nil {
+			return err
+		}
+	}
+	if err := SetSeries(tx, d.Link, d.Series, 0); err != nil {
+		return err
+	}
+	if _, err := SaveRevision(tx, d.Link, d.Body, author); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	d.ID = id
+	return nil
+}
+
+// SetImage chooses a post's preview image; "" goes back to the site's.
+func SetImage(pool *pgxpool.Pool, link string, image string) error {
+	query := `UPDATE posts SET image = NULLIF($2, '') WHERE link = $1`
+	_, err := pool.Exec(context.Background(), query, link, image)
+	return err
+}
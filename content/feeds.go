@@ -0,0 +1,101 @@
+package content
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// FeedComment is a comment along with the post it belongs to, for RSS.
+type FeedComment struct {
+	ID        int       `db:"id"`
+	PostLink  string    `db:"post_link"`
+	PostTitle string    `db:"post_title"`
+	Username  string    `db:"username"`
+	Content   string    `db:"content"`
+	Created   time.Time `db:"created_at"`
+}
+
+// GetCommentFeed returns the newest approved comments, either on one post
+// or (with postID 0) across every published post.
+func GetCommentFeed(pool *pgxpool.Pool, postID int, limit int) ([]FeedComment, error) {
+	query := `
+SELECT c.id, p.link AS post_link, p.title AS post_title,
+COALESCE(u.username, c.guest_name) AS username, c.content, c.created_at
+FROM comments c
+JOIN posts p ON c.post_id = p.id
+LEFT JOIN users u ON c.user_id = u.id
+WHERE c.status = 'approved'
+AND (($1 = 0 AND p.status = 'published' AND p.published_at <= now()) OR c.post_id = $1)
+ORDER BY c.created_at DESC
+LIMIT $2`
+	rows, err := pool.Query(context.Background(), query, postID, limit)
+	if err != nil {
+		return []FeedComment{}, err
+	}
+	defer rows.Close()
+	return pgx.CollectRows(rows, pgx.RowToStructByName[FeedComment])
+}
+
+// GetGemlog lists published posts newest first, dated the way a Gemini
+// gemlog wants (YYYY-MM-DD). A limit of 0 means all of them.
+func GetGemlog(pool *pgxpool.Pool, limit int) ([]Thumbnail, error) {
+	query := `
+SELECT link, title, summary, TO_CHAR(published_at, 'YYYY-MM-DD') AS date, status
+FROM posts
+WHERE status = 'published' AND published_at <= now()
+` + thumbnailOrder + `
+LIMIT NULLIF($1, 0)`
+	rows, err := pool.Query(context.Background(), query, limit)
+	if err != nil {
+		return []Thumbnail{}, err
+	}
+	defer rows.Close()
+	return pgx.CollectRows(rows, pgx.RowToStructByName[Thumbnail])
+}
+
+// FeedPost is a published post, for RSS.
+type FeedPost struct {
+	Link      string    `db:"link"`
+	Title     string    `db:"title"`
+	Summary   string    `db:"summary"`
+	Published time.Time `db:"published_at"`
+}
+
+// GetPostFeed returns the published posts newest first: all of them, or with
+// a tag only the ones tagged with it.
+func GetPostFeed(pool *pgxpool.Pool, tag string) ([]FeedPost, error) {
+	query := `
+SELECT p.link, p.title, p.summary, p.published_at
+FROM posts p
+WHERE p.status = 'published' AND p.published_at <= now()
+AND ($1 = '' OR EXISTS (
+  SELECT 1 FROM post_tags pt JOIN tags t ON pt.tag_id = t.id
+  WHERE pt.post_id = p.id AND t.name = $1))
+ORDER BY p.published_at DESC, p.id DESC`
+	rows, err := pool.Query(context.Background(), query, tag)
+	if err != nil {
+		return []FeedPost{}, err
+	}
+	defer rows.Close()
+	return pgx.CollectRows(rows, pgx.RowToStructByName[FeedPost])
+}
+
+// GetSeriesFeed returns a series' published parts in order.
+func GetSeriesFeed(pool *pgxpool.Pool, slug string) ([]FeedPost, error) {
+	query := `
+SELECT p.link, p.title, p.summary, p.published_at
+FROM series_posts sp
+JOIN series s ON sp.series_id = s.id
+JOIN posts p ON sp.post_id = p.id
+WHERE s.slug = $1 AND p.status = 'published' AND p.published_at <= now()
+ORDER BY sp.position, p.published_at, p.id`
+	rows, err := pool.Query(context.Background(), query, slug)
+	if err != nil {
+		return []FeedPost{}, err
+	}
+	defer rows.Close()
+	return pgx.CollectRows(rows, pgx.RowToStructByName[FeedPost])
+}
@@ -0,0 +1,65 @@
+package content
+
+import (
+	"context"
+	"html/template"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// @name, as long as the @ doesn't follow a word character (so emails don't count)
+var mentionPattern = regexp.MustCompile(`(^|[^\w@])@(\w{1,50})`)
+
+// ParseMentions lists each distinct @username in text, in order of appearance.
+func ParseMentions(text string) []string {
+	var names []string
+	for _, m := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		if !slices.Contains(names, m[2]) {
+			names = append(names, m[2])
+		}
+	}
+	return names
+}
+
+// SaveMentions records which of names are real users, and returns those.
+func SaveMentions(pool *pgxpool.Pool, commentID int, names []string) ([]string, error) {
+	if len(names) == 0 {
+		return []string{}, nil
+	}
+	query := `
+WITH found AS (SELECT id, username FROM users WHERE username = ANY($2)),
+saved AS (INSERT INTO mentions (comment_id, user_id) SELECT $1, id FROM found ON CONFLICT DO NOTHING)
+SELECT username FROM found`
+	rows, err := pool.Query(context.Background(), query, commentID, names)
+	if err != nil {
+		return []string{}, err
+	}
+	defer rows.Close()
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+// HTML is the comment's text with its (validated) mentions linked to profiles.
+func (c Comment) HTML() template.HTML {
+	return linkMentions(c.Content, c.Mentions)
+}
+
+func linkMentions(text string, valid []string) template.HTML {
+	var buf strings.Builder
+	last := 0
+	for _, m := range mentionPattern.FindAllStringSubmatchIndex(text, -1) {
+		name := text[m[4]:m[5]]
+		if !slices.Contains(valid, name) {
+			continue
+		}
+		at := m[4] - 1
+		buf.WriteString(template.HTMLEscapeString(text[last:at]))
+		buf.WriteString(`<a class="mention" href="/users/` + name + `">@` + name + `</a>`) // \w only, nothing to escape
+		last = m[5]
+	}
+	buf.WriteString(template.HTMLEscapeString(text[last:]))
+	return template.HTML(buf.String())
+}
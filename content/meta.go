@@ -0,0 +1,125 @@
+package content
+
+import (
+	"strings"
+	"time"
+)
+
+// Meta describes a page for link previews and search engines: its canonical
+// URL, OpenGraph and Twitter card tags, and schema.org JSON-LD.
+type Meta struct {
+	URL         string // canonical
+	Type        string // OpenGraph type: "website" or "article"
+	SiteName    string
+	Title       string
+	Description string
+	Image       string // absolute URL
+	Card        string // Twitter card: "summary" or "summary_large_image"
+	Published   string // RFC 3339, articles only
+	Modified    string
+	Tags        []string
+	Schema      map[string]any // JSON-LD
+	NoIndex     bool           // for pages to share by link but keep out of search results
+}
+
+// MetaSite is what the metadata of every page on a site shares.
+type MetaSite struct {
+	URL   string // public address, without a trailing slash
+	Name  string
+	Image string // preview image for pages that don't choose their own
+}
+
+// abs makes a site-relative link absolute.
+func (s MetaSite) abs(link string) string {
+	if strings.HasPrefix(link, "/") && !strings.HasPrefix(link, "//") {
+		return s.URL + link
+	}
+	return link
+}
+
+// Page describes an ordinary page at path.
+func (s MetaSite) Page(path, title, description string) *Meta {
+	m := &Meta{
+		URL:         s.abs(path),
+		Type:        "website",
+		SiteName:    s.Name,
+		Title:       title,
+		Description: description,
+		Image:       s.abs(s.Image),
+		Card:        "summary",
+	}
+	m.Schema = map[string]any{
+		"@context":    "https://schema.org",
+		"@type":       "WebPage",
+		"url":         m.URL,
+		"name":        title,
+		"description": description,
+	}
+	return m
+}
+
+// Post describes a post. A post with its own image gets a large preview.
+// Unlisted posts, and drafts their author is looking at, still get previews
+// but ask not to be indexed.
+func (s MetaSite) Post(p Post) *Meta {
+	m := s.Page("/posts/"+p.Link, p.Title, p.Summary)
+	m.NoIndex = p.Status != "published"
+	m.Type = "article"
+	m.Tags = p.Tags
+	if p.Image != "" {
+		m.Image, m.Card = s.abs(p.Image), "summary_large_image"
+	}
+	if !p.Published.IsZero() {
+		m.Published = p.Published.Format(time.RFC3339)
+	}
+	if !p.Updated.IsZero() {
+		m.Modified = p.Updated.Format(time.RFC3339)
+	}
+	m.Schema = map[string]any{
+		"@context":         "https://schema.org",
+		"@type":            "BlogPosting",
+		"mainEntityOfPage": m.URL,
+		"url":              m.URL,
+		"headline":         p.Title,
+		"description":      p.Summary,
+		"image":            m.Image,
+		"author":           map[string]any{"@type": "Person", "name": p.Author, "url": s.URL + "/users/" + p.Author},
+		"publisher":        map[string]any{"@type": "Person", "name": s.Name, "url": s.URL},
+	}
+	if m.Published != "" {
+		m.Schema["datePublished"] = m.Published
+	}
+	if m.Modified != "" {
+		m.Schema["dateModified"] = m.Modified
+	}
+	if len(p.Tags) > 0 {
+		m.Schema["keywords"] = p.Tags
+	}
+	if p.Words > 0 {
+		m.Schema["wordCount"] = p.Words
+	}
+	return m
+}
+
+// Papers describes a page listing papers, each as a ScholarlyArticle.
+func (s MetaSite) Papers(path, title, description string, papers []Thumbnail) *Meta {
+	m := s.Page(path, title, description)
+	articles := []map[string]any{}
+	for _, p := range papers {
+		a := map[string]any{
+			"@type":    "ScholarlyArticle",
+			"url":      s.URL + "/s/papers/" + p.Link,
+			"headline": p.Title,
+			"abstract": p.Summary,
+			"author":   map[string]any{"@type": "Person", "name": s.Name},
+		}
+		// GetPapers dates papers by month, e.g. "March 2024"
+		if t, err := time.Parse("January 2006", p.Date); err == nil {
+			a["datePublished"] = t.Format("2006-01")
+		}
+		articles = append(articles, a)
+	}
+	m.Schema["@type"] = "CollectionPage"
+	m.Schema["hasPart"] = articles
+	return m
+}
@@ -0,0 +1,74 @@
+package content
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PendingComment is a comment waiting in the moderation queue.
+type PendingComment struct {
+	ID        int    `db:"id"`
+	PostID    int    `db:"post_id"`
+	PostLink  string `db:"post_link"`
+	PostTitle string `db:"post_title"`
+	Username  string `db:"username"`
+	Email     string `db:"email"`
+	When      string `db:"when"`
+	Content   string `db:"content"`
+}
+
+// PostGuestComment stores a comment from someone without an account.
+// It stays hidden until an admin approves it.
+func PostGuestComment(pool *pgxpool.Pool, postID int, name, email, content string) (int, error) {
+	id := 0
+	query := `
+INSERT INTO comments (post_id, guest_name, guest_email, content, status)
+VALUES ($1, $2, $3, $4, 'pending') RETURNING id`
+	err := pool.QueryRow(context.Background(), query, postID, name, email, content).Scan(&id)
+	return id, err
+}
+
+func GetPendingComments(pool *pgxpool.Pool) ([]PendingComment, error) {
+	query := `
+SELECT c.id, c.post_id, p.link AS post_link, p.title AS post_title,
+COALESCE(u.username, c.guest_name) AS username, COALESCE(u.email, c.guest_email) AS email,
+time_format(c.created_at) AS when, c.content
+FROM comments c
+JOIN posts p ON c.post_id = p.id
+LEFT JOIN users u ON c.user_id = u.id
+WHERE c.status = 'pending'
+ORDER BY c.created_at ASC`
+	rows, err := pool.Query(context.Background(), query)
+	if err != nil {
+		return []PendingComment{}, err
+	}
+	defer rows.Close()
+	return pgx.CollectRows(rows, pgx.RowToStructByName[PendingComment])
+}
+
+// ModerateComment approves or rejects a pending comment, returning it so an
+// approved comment can be pushed out to readers.
+func ModerateComment(pool *pgxpool.Pool, id int, approve bool) (PendingComment, error) {
+	status := "rejected"
+	if approve {
+		status = "approved"
+	}
+	query := `
+WITH rows AS
+(UPDATE comments SET status = $2, updated_at = CURRENT_TIMESTAMP
+ WHERE id = $1 AND status = 'pending' RETURNING *)
+SELECT c.id, c.post_id, p.link AS post_link, p.title AS post_title,
+COALESCE(u.username, c.guest_name) AS username, COALESCE(u.email, c.guest_email) AS email,
+time_format(c.created_at) AS when, c.content
+FROM rows c
+JOIN posts p ON c.post_id = p.id
+LEFT JOIN users u ON c.user_id = u.id`
+	rows, err := pool.Query(context.Background(), query, id, status)
+	if err != nil {
+		return PendingComment{}, err
+	}
+	defer rows.Close()
+	return pgx.CollectOneRow(rows, pgx.RowToStructByName[PendingComment])
+}
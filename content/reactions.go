@@ -0,0 +1,174 @@
+package content
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// the fixed set of reactions, in display order
+var ReactionKinds = []string{"like", "love", "laugh", "think"}
+
+var reactionEmoji = map[string]string{
+	"like":  "👍",
+	"love":  "❤️",
+	"laugh": "😄",
+	"think": "🤔",
+}
+
+type Reaction struct {
+	Kind  string
+	Emoji string
+	Count int
+	Mine  bool // did the current user pick this one?
+}
+
+// Reactions is everything needed to render the buttons for one post or comment.
+type Reactions struct {
+	Target string // "post" or "comment"
+	ID     int
+	Counts []Reaction
+}
+
+func ValidReaction(kind string) bool {
+	_, ok := reactionEmoji[kind]
+	return ok
+}
+
+func NewReactions(target string, id int) Reactions {
+	r := Reactions{Target: target, ID: id}
+	for _, k := range ReactionKinds {
+		r.Counts = append(r.Counts, Reaction{Kind: k, Emoji: reactionEmoji[k]})
+	}
+	return r
+}
+
+func (r *Reactions) add(kind string, count int, mine bool) {
+	for i := range r.Counts {
+		if r.Counts[i].Kind == kind {
+			r.Counts[i].Count = count
+			r.Counts[i].Mine = mine
+		}
+	}
+}
+
+// only ever interpolated from this map, never from user input
+var reactionColumn = map[string]string{
+	"post":    "post_id",
+	"comment": "comment_id",
+}
+
+// ErrNoTarget means the post or comment doesn't exist, as far as the user can see.
+var ErrNoTarget = errors.New("no such post or comment")
+
+// postVisible says whether post p, by author a, is visible to the user named
+// $2, as Post.Visible does.
+const postVisible = `(p.status IN ('published', 'unlisted') OR a.username = $2)`
+
+// commentVisible says the same of comment c on post p, written by user u
+// unless it's a guest's.
+const commentVisible = `(c.status = 'approved' OR (c.status = 'shadow' AND u.username = $2))
+AND ` + postVisible
+
+// what a user may react to: the same posts and comments they can read
+var reactionVisible = map[string]string{
+	"post": `
+SELECT EXISTS (SELECT 1 FROM posts p JOIN users a ON p.author_id = a.id
+WHERE p.id = $1 AND ` + postVisible + `)`,
+	"comment": `
+SELECT EXISTS (SELECT 1 FROM comments c
+JOIN posts p ON c.post_id = p.id
+JOIN users a ON p.author_id = a.id
+LEFT JOIN users u ON c.user_id = u.id
+WHERE c.id = $1 AND ` + commentVisible + `)`,
+}
+
+// ToggleReaction adds the user's reaction, or removes it if it was already there.
+func ToggleReaction(pool *pgxpool.Pool, target string, id int, username, kind string) error {
+	col, ok := reactionColumn[target]
+	if !ok || !ValidReaction(kind) {
+		return errors.New("invalid reaction")
+	}
+	var visible bool
+	if err := pool.QueryRow(context.Background(), reactionVisible[target], id, username).Scan(&visible); err != nil {
+		return err
+	}
+	if !visible {
+		return ErrNoTarget
+	}
+	del := `
+DELETE FROM reactions
+WHERE ` + col + ` = $1 AND kind = $3 AND user_id = (SELECT id FROM users WHERE username = $2)`
+	tag, err := pool.Exec(context.Background(), del, id, username, kind)
+	if err != nil || tag.RowsAffected() > 0 {
+		return err
+	}
+	ins := `
+INSERT INTO reactions (` + col + `, user_id, kind)
+VALUES ($1, (SELECT id FROM users WHERE username = $2), $3)
+ON CONFLICT DO NOTHING`
+	_, err = pool.Exec(context.Background(), ins, id, username, kind)
+	return err
+}
+
+func GetReactions(pool *pgxpool.Pool, target string, id int, username string) (Reactions, error) {
+	r := NewReactions(target, id)
+	col, ok := reactionColumn[target]
+	if !ok {
+		return r, errors.New("invalid reaction target")
+	}
+	query := `
+SELECT r.kind, count(*), COALESCE(bool_or(u.username = $2), false)
+FROM reactions r
+JOIN users u ON r.user_id = u.id
+WHERE r.` + col + ` = $1
+GROUP BY r.kind`
+	rows, err := pool.Query(context.Background(), query, id, username)
+	if err != nil {
+		return r, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var kind string
+		var count int
+		var mine bool
+		if err := rows.Scan(&kind, &count, &mine); err != nil {
+			return r, err
+		}
+		r.add(kind, count, mine)
+	}
+	return r, rows.Err()
+}
+
+// GetCommentReactions counts reactions for every comment on a post in one query.
+func GetCommentReactions(pool *pgxpool.Pool, postID int, username string) (map[int]Reactions, error) {
+	query := `
+SELECT r.comment_id, r.kind, count(*), COALESCE(bool_or(u.username = $2), false)
+FROM reactions r
+JOIN comments c ON r.comment_id = c.id
+JOIN users u ON r.user_id = u.id
+WHERE c.post_id = $1
+GROUP BY r.comment_id, r.kind`
+	result := map[int]Reactions{}
+	rows, err := pool.Query(context.Background(), query, postID, username)
+	if err != nil {
+		return result, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var commentID, count int
+		var kind string
+		var mine bool
+		if err := rows.Scan(&commentID, &kind, &count, &mine); err != nil {
+			return result, err
+		}
+		r, ok := result[commentID]
+		if !ok {
+			r = NewReactions("comment", commentID)
+		}
+		r.add(kind, count, mine)
+		result[commentID] = r
+	}
+	return result, rows.Err()
+}
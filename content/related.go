@@ -0,0 +1,70 @@
+package content
+
+import (
+	"context"
+
+	"siteserver/related"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// UpdateRelated recomputes the n most similar posts for every published
+// post. It reads every post, so it's meant for the indexer, not requests.
+func UpdateRelated(pool *pgxpool.Pool, n int) error {
+	ctx := context.Background()
+	query := `
+SELECT p.id, p.title, p.summary, COALESCE(p.body_text, '') AS body,
+COALESCE(array_agg(t.name) FILTER (WHERE t.name IS NOT NULL), '{}') AS tags
+FROM posts p
+LEFT JOIN post_tags pt ON pt.post_id = p.id
+LEFT JOIN tags t ON pt.tag_id = t.id
+WHERE p.status = 'published'
+GROUP BY p.id`
+	rows, err := pool.Query(ctx, query)
+	if err != nil {
+		return err
+	}
+	docs, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (related.Doc, error) {
+		var d related.Doc
+		err := row.Scan(&d.ID, &d.Title, &d.Summary, &d.Body, &d.Tags)
+		return d, err
+	})
+	if err != nil {
+		return err
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, `DELETE FROM related_posts`); err != nil {
+		return err
+	}
+	for id, matches := range related.Compute(docs, n) {
+		for _, m := range matches {
+			query := `INSERT INTO related_posts (post_id, related_id, score) VALUES ($1, $2, $3)`
+			if _, err := tx.Exec(ctx, query, id, m.ID, m.Score); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// GetRelated returns the posts most like a post, best first.
+func GetRelated(pool *pgxpool.Pool, postID int) ([]Thumbnail, error) {
+	query := `
+SELECT p.link, p.title, p.summary, time_format(p.published_at) AS date, p.status
+FROM related_posts r
+JOIN posts p ON r.related_id = p.id
+WHERE r.post_id = $1 AND p.status = 'published' AND p.published_at <= now()
+ORDER BY r.score DESC`
+	rows, err := pool.Query(context.Background(), query, postID)
+	if err != nil {
+		return []Thumbnail{}, err
+	}
+	defer rows.Close()
+	return pgx.CollectRows(rows, pgx.RowToStructByName[Thumbnail])
+}
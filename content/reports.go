@@ -0,0 +1,96 @@
+package content
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Report is a reported comment with every open report against it.
+type Report struct {
+	CommentID int      `db:"comment_id"`
+	PostLink  string   `db:"post_link"`
+	PostTitle string   `db:"post_title"`
+	Username  string   `db:"username"`
+	Guest     bool     `db:"guest"`
+	Content   string   `db:"content"`
+	When      string   `db:"when"`
+	Reports   int      `db:"reports"`
+	Reasons   []string `db:"reasons"`
+}
+
+// ReportComment records a report, or ErrNoTarget if the reporter can't see
+// the comment.
+func ReportComment(pool *pgxpool.Pool, commentID int, reporter, reason string) error {
+	query := `
+INSERT INTO reports (comment_id, reporter_id, reason)
+SELECT c.id, r.id, $3
+FROM comments c
+JOIN posts p ON c.post_id = p.id
+JOIN users a ON p.author_id = a.id
+JOIN users r ON r.username = $2
+LEFT JOIN users u ON c.user_id = u.id
+WHERE c.id = $1 AND ` + commentVisible + `
+ON CONFLICT (comment_id, reporter_id) DO UPDATE SET reason = EXCLUDED.reason`
+	tag, err := pool.Exec(context.Background(), query, commentID, reporter, reason)
+	if err == nil && tag.RowsAffected() == 0 {
+		return ErrNoTarget
+	}
+	return err
+}
+
+// GetReports lists open reports, most-reported comments first.
+func GetReports(pool *pgxpool.Pool) ([]Report, error) {
+	query := `
+SELECT c.id AS comment_id, p.link AS post_link, p.title AS post_title,
+COALESCE(u.username, c.guest_name) AS username, c.user_id IS NULL AS guest,
+c.content, time_format(c.created_at) AS when,
+count(*)::int AS reports, array_remove(array_agg(r.reason), '') AS reasons
+FROM reports r
+JOIN comments c ON r.comment_id = c.id
+JOIN posts p ON c.post_id = p.id
+LEFT JOIN users u ON c.user_id = u.id
+WHERE r.resolution IS NULL
+GROUP BY c.id, p.link, p.title, u.username
+ORDER BY count(*) DESC, min(r.created_at) ASC`
+	rows, err := pool.Query(context.Background(), query)
+	if err != nil {
+		return []Report{}, err
+	}
+	defer rows.Close()
+	return pgx.CollectRows(rows, pgx.RowToStructByName[Report])
+}
+
+// ResolveReports closes every open report on a comment, taking the comment
+// down if remove is set. It returns who reported it, so they can be told.
+func ResolveReports(pool *pgxpool.Pool, commentID int, remove bool) ([]string, error) {
+	ctx := context.Background()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return []string{}, err
+	}
+	defer tx.Rollback(ctx)
+	resolution := "dismissed"
+	if remove {
+		resolution = "removed"
+		query := `UPDATE comments SET status = 'removed', updated_at = CURRENT_TIMESTAMP WHERE id = $1`
+		if _, err := tx.Exec(ctx, query, commentID); err != nil {
+			return []string{}, err
+		}
+	}
+	query := `
+WITH rows AS
+(UPDATE reports SET resolution = $2, resolved_at = CURRENT_TIMESTAMP
+ WHERE comment_id = $1 AND resolution IS NULL RETURNING reporter_id)
+SELECT u.username FROM rows r JOIN users u ON r.reporter_id = u.id`
+	rows, err := tx.Query(ctx, query, commentID, resolution)
+	if err != nil {
+		return []string{}, err
+	}
+	reporters, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return []string{}, err
+	}
+	return reporters, tx.Commit(ctx)
+}
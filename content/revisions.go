@@ -0,0 +1,92 @@
+package content
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Revision struct {
+	ID      int    `db:"id"`
+	Hash    string `db:"hash"`
+	Author  string `db:"author"` // empty if the user is gone
+	When    string `db:"when"`
+	Content string `db:"content"`
+}
+
+// Short is the first few characters of the hash, like a git commit.
+func (r Revision) Short() string {
+	return r.Hash[:min(len(r.Hash), 8)]
+}
+
+// SaveRevision records body as the post's newest revision, unless it's the
+// same as the current one. Every revision after the first also bumps the
+// post's updated_at.
+func SaveRevision(db Conn, link string, body string, author string) (bool, error) {
+	sum := sha256.Sum256([]byte(body))
+	hash := hex.EncodeToString(sum[:])
+	ctx := context.Background()
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+	var postID int
+	if err := tx.QueryRow(ctx, `SELECT id FROM posts WHERE link = $1 FOR UPDATE`, link).Scan(&postID); err != nil {
+		return false, err
+	}
+	var latest string
+	err = tx.QueryRow(ctx, `SELECT hash FROM revisions WHERE post_id = $1 ORDER BY id DESC LIMIT 1`, postID).Scan(&latest)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return false, err
+	}
+	if latest == hash {
+		return false, nil
+	}
+	query := `INSERT INTO revisions (post_id, hash, content, author_id) VALUES ($1, $2, $3, (SELECT id FROM users WHERE username = $4))`
+	if _, err := tx.Exec(ctx, query, postID, hash, body, author); err != nil {
+		return false, err
+	}
+	if latest != "" {
+		if _, err := tx.Exec(ctx, `UPDATE posts SET updated_at = CURRENT_TIMESTAMP WHERE id = $1`, postID); err != nil {
+			return false, err
+		}
+	}
+	return true, tx.Commit(ctx)
+}
+
+// GetRevisions lists a post's revisions, newest first.
+func GetRevisions(pool *pgxpool.Pool, link string) ([]Revision, error) {
+	query := `
+SELECT r.id, r.hash, COALESCE(u.username, '') AS author, time_format(r.created_at) AS when, r.content
+FROM revisions r
+JOIN posts p ON r.post_id = p.id
+LEFT JOIN users u ON r.author_id = u.id
+WHERE p.link = $1
+ORDER BY r.id DESC`
+	rows, err := pool.Query(context.Background(), query, link)
+	if err != nil {
+		return []Revision{}, err
+	}
+	defer rows.Close()
+	return pgx.CollectRows(rows, pgx.RowToStructByName[Revision])
+}
+
+// RestoreRevision makes an old revision the post's body again, as a new
+// revision by whoever restored it.
+func RestoreRevision(pool *pgxpool.Pool, link string, id int, by string) error {
+	var body string
+	query := `SELECT r.content FROM revisions r JOIN posts p ON r.post_id = p.id WHERE p.link = $1 AND r.id = $2`
+	if err := pool.QueryRow(context.Background(), query, link, id).Scan(&body); err != nil {
+		return err
+	}
+	if err := SetBody(pool, link, body); err != nil {
+		return err
+	}
+	_, err := SaveRevision(pool, link, body, by)
+	return err
+}
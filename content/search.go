@@ -0,0 +1,106 @@
+package content
+
+import (
+	"context"
+	"html/template"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/net/html"
+)
+
+type SearchResult struct {
+	Kind    string  `db:"kind"` // "post" or "paper"
+	Link    string  `db:"link"`
+	Title   string  `db:"title"`
+	Snippet string  `db:"snippet"`
+	Rank    float32 `db:"rank"`
+}
+
+// ts_headline marks matches with these; they're swapped for <mark> after escaping
+const (
+	markStart = "⟦"
+	markStop  = "⟧"
+)
+
+// Highlight is the snippet as HTML, with matching words in <mark>.
+func (r SearchResult) Highlight() template.HTML {
+	s := template.HTMLEscapeString(r.Snippet)
+	s = strings.ReplaceAll(s, markStart, "<mark>")
+	s = strings.ReplaceAll(s, markStop, "</mark>")
+	return template.HTML(s)
+}
+
+// Search ranks published posts and papers against a web-style query
+// ("quoted phrases", -excluded, or).
+// Projects are still hardcoded in their template, so they aren't searched.
+func Search(pool *pgxpool.Pool, q string, limit int) ([]SearchResult, error) {
+	query := `
+WITH q AS (SELECT websearch_to_tsquery('english', $1) AS query)
+SELECT kind, link, title, snippet, rank FROM (
+  SELECT 'post' AS kind, '/posts/' || p.link AS link, p.title,
+  ts_headline('english', p.summary || ' ' || coalesce(p.body_text, ''), q.query, $3) AS snippet,
+  ts_rank(p.search, q.query) AS rank
+  FROM posts p, q
+  WHERE p.search @@ q.query AND p.status = 'published' AND p.published_at <= now()
+  UNION ALL
+  SELECT 'paper', '/s/papers/' || a.file, a.title,
+  ts_headline('english', a.abstract, q.query, $3),
+  ts_rank(a.search, q.query)
+  FROM papers a, q
+  WHERE a.search @@ q.query
+) results
+ORDER BY rank DESC
+LIMIT $2`
+	options := "StartSel=" + markStart + ", StopSel=" + markStop + ", MaxFragments=2, MaxWords=25, MinWords=10, FragmentDelimiter=\" … \""
+	rows, err := pool.Query(context.Background(), query, q, limit, options)
+	if err != nil {
+		return []SearchResult{}, err
+	}
+	defer rows.Close()
+	return pgx.CollectRows(rows, pgx.RowToStructByName[SearchResult])
+}
+
+// PlainText strips the markup from an HTML fragment, for the search index.
+func PlainText(htmlBody string) string {
+	doc, err := html.Parse(strings.NewReader(htmlBody))
+	if err != nil {
+		return ""
+	}
+	var buf strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && (n.Data == "script" || n.Data == "style") {
+			return
+		}
+		if n.Type == html.TextNode {
+			buf.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return strings.Join(strings.Fields(buf.String()), " ")
+}
+
+// SetBodyText updates the text a post is searched by.
+func SetBodyText(pool *pgxpool.Pool, link string, text string) error {
+	query := `UPDATE posts SET body_text = $2 WHERE link = $1`
+	_, err := pool.Exec(context.Background(), query, link, text)
+	return err
+}
+
+func GetPapers(pool *pgxpool.Pool) ([]Thumbnail, error) {
+	query := `
+SELECT file AS link, title, abstract AS summary, TO_CHAR(published, 'FMMonth YYYY') AS date, 'published' AS status
+FROM papers
+ORDER BY published DESC`
+	rows, err := pool.Query(context.Background(), query)
+	if err != nil {
+		return []Thumbnail{}, err
+	}
+	defer rows.Close()
+	return pgx.CollectRows(rows, pgx.RowToStructByName[Thumbnail])
+}
@@ -0,0 +1,139 @@
+package content
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Series is an ordered run of posts, e.g. a multi-part build log.
+type Series struct {
+	Slug    string      `db:"slug"`
+	Title   string      `db:"title"`
+	Summary string      `db:"summary"`
+	Parts   []Thumbnail `db:"-"` // published parts, in order
+	Current string      `db:"-"` // link of the post being read, if any
+}
+
+// Index is the current post's place in Parts, or -1.
+func (s *Series) Index() int {
+	for i, p := range s.Parts {
+		if p.Link == s.Current {
+			return i
+		}
+	}
+	return -1
+}
+
+// Part is the current post's part number, counting from 1.
+func (s *Series) Part() int {
+	return s.Index() + 1
+}
+
+func (s *Series) Prev() *Thumbnail {
+	if i := s.Index(); i > 0 {
+		return &s.Parts[i-1]
+	}
+	return nil
+}
+
+func (s *Series) Next() *Thumbnail {
+	if i := s.Index(); i >= 0 && i+1 < len(s.Parts) {
+		return &s.Parts[i+1]
+	}
+	return nil
+}
+
+// SetSeries puts a post in the series with the given title, creating it if
+// need be, as part number position. A position of 0 keeps the post's place if
+// it's already in the series, and otherwise puts it last. An empty title
+// takes the post out of whatever series it was in.
+func SetSeries(db Conn, link, title string, position int) error {
+	ctx := context.Background()
+	slug := TagSlug(title)
+	if slug == "" {
+		query := `DELETE FROM series_posts WHERE post_id = (SELECT id FROM posts WHERE link = $1)`
+		_, err := db.Exec(ctx, query, link)
+		return err
+	}
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	var seriesID int
+	query := `
+INSERT INTO series (slug, title) VALUES ($1, $2)
+ON CONFLICT (slug) DO UPDATE SET title = EXCLUDED.title
+RETURNING id`
+	if err := tx.QueryRow(ctx, query, slug, title).Scan(&seriesID); err != nil {
+		return err
+	}
+	query = `
+INSERT INTO series_posts (post_id, series_id, position)
+SELECT p.id, $2::int, CASE WHEN $3::int > 0 THEN $3::int
+  ELSE (SELECT COALESCE(max(position), 0) + 1 FROM series_posts WHERE series_id = $2) END
+FROM posts p WHERE p.link = $1
+ON CONFLICT (post_id) DO UPDATE SET series_id = EXCLUDED.series_id,
+  position = CASE WHEN $3::int > 0 OR series_posts.series_id <> EXCLUDED.series_id THEN EXCLUDED.position ELSE series_posts.position END`
+	if _, err := tx.Exec(ctx, query, link, seriesID, position); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// GetSeries returns a series and its published parts, or nil if there's no
+// such series.
+func GetSeries(pool *pgxpool.Pool, slug string) (*Series, error) {
+	query := `SELECT slug, title, summary FROM series WHERE slug = $1`
+	rows, err := pool.Query(context.Background(), query, slug)
+	if err != nil {
+		return nil, err
+	}
+	s, err := pgx.CollectOneRow(rows, pgx.RowToAddrOfStructByName[Series])
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	query = `
+SELECT p.link, p.title, p.summary, time_format(p.published_at) AS date, p.status
+FROM series_posts sp
+JOIN series s ON sp.series_id = s.id
+JOIN posts p ON sp.post_id = p.id
+WHERE s.slug = $1 AND p.status = 'published' AND p.published_at <= now()
+ORDER BY sp.position, p.published_at, p.id`
+	rows, err = pool.Query(context.Background(), query, slug)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	s.Parts, err = pgx.CollectRows(rows, pgx.RowToStructByName[Thumbnail])
+	return s, err
+}
+
+// GetPostSeries returns the series a post belongs to, with the post marked
+// as Current, or nil if it isn't in one.
+func GetPostSeries(pool *pgxpool.Pool, link string) (*Series, error) {
+	var slug string
+	query := `
+SELECT s.slug FROM series s
+JOIN series_posts sp ON sp.series_id = s.id
+JOIN posts p ON sp.post_id = p.id
+WHERE p.link = $1`
+	err := pool.QueryRow(context.Background(), query, link).Scan(&slug)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s, err := GetSeries(pool, slug)
+	if s != nil {
+		s.Current = link
+	}
+	return s, err
+}
@@ -0,0 +1,115 @@
+package content
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"siteserver/gemtext"
+	"siteserver/markdown"
+	"siteserver/org"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrNoBody = errors.New("content: post has no body")
+
+// Body is a post's source text and the format it's written in.
+type Body struct {
+	Format string // file extension without the dot, e.g. "html"
+	Text   []byte
+}
+
+// HTML renders the body for a web page, whatever it's written in.
+func (b Body) HTML() template.HTML {
+	switch b.Format {
+	case "md":
+		return template.HTML(markdown.Render(b.Text, markdown.Posts))
+	case "gmi":
+		return template.HTML(gemtext.Parse(b.Text).HTML())
+	case "org":
+		return template.HTML(org.Parse(b.Text).HTML)
+	}
+	return template.HTML(b.Text)
+}
+
+// Source is somewhere post bodies can come from.
+// It returns ErrNoBody when it simply doesn't have the post.
+type Source interface {
+	Body(link string) (Body, error)
+}
+
+// Sources tries each Source in turn, e.g. the database and then the filesystem.
+type Sources []Source
+
+func (ss Sources) Body(link string) (Body, error) {
+	for _, s := range ss {
+		b, err := s.Body(link)
+		if errors.Is(err, ErrNoBody) {
+			continue
+		}
+		return b, err
+	}
+	return Body{}, ErrNoBody
+}
+
+// DBSource serves bodies from posts.content.
+type DBSource struct {
+	Pool *pgxpool.Pool
+}
+
+func (s DBSource) Body(link string) (Body, error) {
+	var text *string
+	query := `SELECT content FROM posts WHERE link = $1`
+	err := s.Pool.QueryRow(context.Background(), query, link).Scan(&text)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && text == nil) {
+		return Body{}, ErrNoBody
+	}
+	if err != nil {
+		return Body{}, err
+	}
+	return Body{Format: "html", Text: []byte(*text)}, nil
+}
+
+// DirSource serves bodies from files named <link>.<format> in Dir.
+type DirSource struct {
+	Dir     string
+	Formats []string // extensions to look for, in order of preference
+}
+
+func (s DirSource) Body(link string) (Body, error) {
+	if link == "" || strings.ContainsAny(link, `/\`) || strings.HasPrefix(link, ".") {
+		return Body{}, ErrNoBody
+	}
+	formats := s.Formats
+	if len(formats) == 0 {
+		formats = []string{"html"}
+	}
+	for _, format := range formats {
+		text, err := os.ReadFile(filepath.Join(s.Dir, link+"."+format))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return Body{}, err
+		}
+		return Body{Format: format, Text: text}, nil
+	}
+	return Body{}, ErrNoBody
+}
+
+// SetBody stores a post's body in the database, where it takes precedence
+// over any file with the same name.
+func SetBody(pool *pgxpool.Pool, link string, body string) error {
+	query := `UPDATE posts SET content = $2, body_text = $3, updated_at = CURRENT_TIMESTAMP WHERE link = $1`
+	tag, err := pool.Exec(context.Background(), query, link, body, PlainText(body))
+	if err == nil && tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	return err
+}
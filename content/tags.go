@@ -0,0 +1,109 @@
+package content
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Tag struct {
+	Name  string `db:"name"`
+	Count int    `db:"count"`
+}
+
+var notTagChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// TagSlug normalizes a tag so "Machine Learning" and "machine-learning" are the same.
+func TagSlug(s string) string {
+	return strings.Trim(notTagChars.ReplaceAllString(strings.ToLower(s), "-"), "-")
+}
+
+// ParseTags splits a comma-separated keyword list (as in <meta name="keywords">).
+func ParseTags(keywords string) []string {
+	var tags []string
+	seen := map[string]bool{}
+	for _, k := range strings.Split(keywords, ",") {
+		if t := TagSlug(k); t != "" && !seen[t] && len(t) <= 50 {
+			seen[t] = true
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// SetTags replaces a post's tags.
+func SetTags(pool *pgxpool.Pool, link string, tags []string) error {
+	ctx := context.Background()
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	query := `DELETE FROM post_tags WHERE post_id = (SELECT id FROM posts WHERE link = $1)`
+	if _, err := tx.Exec(ctx, query, link); err != nil {
+		return err
+	}
+	query = `INSERT INTO tags (name) SELECT unnest($1::text[]) ON CONFLICT (name) DO NOTHING`
+	if _, err := tx.Exec(ctx, query, tags); err != nil {
+		return err
+	}
+	query = `
+INSERT INTO post_tags (post_id, tag_id)
+SELECT p.id, t.id FROM posts p, tags t
+WHERE p.link = $1 AND t.name = ANY($2)`
+	if _, err := tx.Exec(ctx, query, link, tags); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func GetPostTags(pool *pgxpool.Pool, postID int) ([]string, error) {
+	query := `
+SELECT t.name FROM post_tags pt
+JOIN tags t ON pt.tag_id = t.id
+WHERE pt.post_id = $1
+ORDER BY t.name`
+	rows, err := pool.Query(context.Background(), query, postID)
+	if err != nil {
+		return []string{}, err
+	}
+	defer rows.Close()
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+// GetTags lists every tag used by a published post, with how many posts use it.
+func GetTags(pool *pgxpool.Pool) ([]Tag, error) {
+	query := `
+SELECT t.name, count(*)::int AS count
+FROM tags t
+JOIN post_tags pt ON pt.tag_id = t.id
+JOIN posts p ON pt.post_id = p.id
+WHERE p.status = 'published' AND p.published_at <= now()
+GROUP BY t.name
+ORDER BY count(*) DESC, t.name`
+	rows, err := pool.Query(context.Background(), query)
+	if err != nil {
+		return []Tag{}, err
+	}
+	defer rows.Close()
+	return pgx.CollectRows(rows, pgx.RowToStructByName[Tag])
+}
+
+func GetTaggedThumbnails(pool *pgxpool.Pool, tag string) ([]Thumbnail, error) {
+	query := `
+SELECT p.link, p.title, p.summary, time_format(p.published_at) AS date, p.status
+FROM posts p
+JOIN post_tags pt ON pt.post_id = p.id
+JOIN tags t ON pt.tag_id = t.id
+WHERE t.name = $1 AND p.status = 'published' AND p.published_at <= now()
+ORDER BY p.published_at DESC, p.id DESC`
+	rows, err := pool.Query(context.Background(), query, tag)
+	if err != nil {
+		return []Thumbnail{}, err
+	}
+	defer rows.Close()
+	return pgx.CollectRows(rows, pgx.RowToStructByName[Thumbnail])
+}
@@ -0,0 +1,54 @@
+package content
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Webmention struct {
+	URL        string `db:"url"`
+	AuthorName string `db:"author_name"`
+	AuthorURL  string `db:"author_url"`
+	Content    string `db:"content"`
+	When       string `db:"when"`
+}
+
+// AddWebmention records an unverified mention, or marks an existing one for re-verification.
+func AddWebmention(pool *pgxpool.Pool, postID int, source string) error {
+	query := `
+INSERT INTO webmentions (post_id, source, url) VALUES ($1, $2, $2)
+ON CONFLICT (post_id, source) DO UPDATE SET updated_at = CURRENT_TIMESTAMP`
+	_, err := pool.Exec(context.Background(), query, postID, source)
+	return err
+}
+
+func VerifyWebmention(pool *pgxpool.Pool, postID int, source, url, authorName, authorURL, content, published string) error {
+	query := `
+UPDATE webmentions SET url = $3, author_name = $4, author_url = $5, content = $6, published = $7,
+verified = true, updated_at = CURRENT_TIMESTAMP
+WHERE post_id = $1 AND source = $2`
+	_, err := pool.Exec(context.Background(), query, postID, source, url, authorName, authorURL, content, published)
+	return err
+}
+
+func DeleteWebmention(pool *pgxpool.Pool, postID int, source string) error {
+	query := `DELETE FROM webmentions WHERE post_id = $1 AND source = $2`
+	_, err := pool.Exec(context.Background(), query, postID, source)
+	return err
+}
+
+func GetWebmentions(pool *pgxpool.Pool, postID int) ([]Webmention, error) {
+	query := `
+SELECT url, author_name, author_url, content, time_format(created_at) AS when
+FROM webmentions
+WHERE post_id = $1 AND verified
+ORDER BY created_at ASC`
+	rows, err := pool.Query(context.Background(), query, postID)
+	if err != nil {
+		return []Webmention{}, err
+	}
+	defer rows.Close()
+	return pgx.CollectRows(rows, pgx.RowToStructByName[Webmention])
+}
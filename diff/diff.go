@@ -0,0 +1,290 @@
+// Package diff compares two texts line by line, and word by word within the
+// lines that changed.
+package diff
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Kinds of Line and Span.
+const (
+	Equal  = "equal"
+	Insert = "insert"
+	Delete = "delete"
+	Skip   = "skip" // a run of unchanged lines left out of the output
+)
+
+// Span is a piece of a line. In a changed line the words that differ are
+// Insert or Delete spans and the rest are Equal.
+type Span struct {
+	Kind string
+	Text string
+}
+
+type Line struct {
+	Kind  string
+	Spans []Span
+}
+
+// Context is how many unchanged lines are kept around each change.
+var Context = 3
+
+// Lines diffs a against b. Unchanged runs longer than the context around them
+// are collapsed into a single Skip line.
+func Lines(a, b string) []Line {
+	ops := compare(split(a), split(b))
+	var out []Line
+	for i := 0; i < len(ops); {
+		if ops[i].kind != Equal {
+			// pair up a block of deletions with the insertions after it,
+			// so that a small edit shows up as a few changed words
+			j := i
+			for j < len(ops) && ops[j].kind == Delete {
+				j++
+			}
+			k := j
+			for k < len(ops) && ops[k].kind == Insert {
+				k++
+			}
+			dels, ins := ops[i:j], ops[j:k]
+			paired := min(len(dels), len(ins))
+			for n := 0; n < paired; n++ {
+				old, new := Words(dels[n].text, ins[n].text)
+				out = append(out, Line{Delete, old}, Line{Insert, new})
+			}
+			for _, op := range dels[paired:] {
+				out = append(out, Line{Delete, []Span{{Delete, op.text}}})
+			}
+			for _, op := range ins[paired:] {
+				out = append(out, Line{Insert, []Span{{Insert, op.text}}})
+			}
+			i = k
+			continue
+		}
+		j := i
+		for j < len(ops) && ops[j].kind == Equal {
+			j++
+		}
+		run := ops[i:j]
+		head, tail := Context, Context
+		if i == 0 {
+			head = 0
+		}
+		if j == len(ops) {
+			tail = 0
+		}
+		if len(run) > head+tail+1 {
+			for _, op := range run[:head] {
+				out = append(out, Line{Equal, []Span{{Equal, op.text}}})
+			}
+			skipped := fmt.Sprintf("… %d unchanged lines", len(run)-head-tail)
+			out = append(out, Line{Skip, []Span{{Skip, skipped}}})
+			run = run[len(run)-tail:]
+		}
+		for _, op := range run {
+			out = append(out, Line{Equal, []Span{{Equal, op.text}}})
+		}
+		i = j
+	}
+	return out
+}
+
+// Words diffs two versions of a line and returns each side's spans.
+func Words(a, b string) (old, new []Span) {
+	for _, op := range compare(tokenize(a), tokenize(b)) {
+		if op.kind != Insert {
+			old = appendSpan(old, Span{op.kind, op.text})
+		}
+		if op.kind != Delete {
+			new = appendSpan(new, Span{op.kind, op.text})
+		}
+	}
+	return old, new
+}
+
+func appendSpan(spans []Span, s Span) []Span {
+	if n := len(spans); n > 0 && spans[n-1].Kind == s.Kind {
+		spans[n-1].Text += s.Text
+		return spans
+	}
+	return append(spans, s)
+}
+
+func split(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// tokenize splits a line into words, runs of space and single punctuation
+// marks, so that joining the tokens gives back the line.
+func tokenize(s string) []string {
+	var tokens []string
+	class := func(r rune) int {
+		switch {
+		case unicode.IsSpace(r):
+			return 0
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			return 1
+		}
+		return 2
+	}
+	start := 0
+	prev := -1
+	for i, r := range s {
+		c := class(r)
+		if i > start && (c != prev || c == 2) {
+			tokens = append(tokens, s[start:i])
+			start = i
+		}
+		prev = c
+	}
+	if start < len(s) {
+		tokens = append(tokens, s[start:])
+	}
+	return tokens
+}
+
+type op struct {
+	kind string
+	text string
+}
+
+// maxCompare bounds the lines (or words) a single change may span before it's
+// shown as replaced outright instead of searched for common parts: history
+// pages are public, and the search is quadratic in the worst case.
+var maxCompare = 2000
+
+// compare finds a shortest edit script from a to b (Myers' algorithm, in
+// linear space), deletions first wherever both sides changed.
+func compare(a, b []string) []op {
+	var ops []op
+	edits(a, b, &ops)
+	// put each run of changes in order: deletions, then insertions
+	for i := 0; i < len(ops); {
+		if ops[i].kind == Equal {
+			i++
+			continue
+		}
+		j := i
+		for j < len(ops) && ops[j].kind != Equal {
+			j++
+		}
+		run := ops[i:j]
+		sort.SliceStable(run, func(x, y int) bool { return run[x].kind == Delete && run[y].kind == Insert })
+		i = j
+	}
+	return ops
+}
+
+func edits(a, b []string, ops *[]op) {
+	// common prefix and suffix are cheap and usually most of a post
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+	for _, s := range a[:pre] {
+		*ops = append(*ops, op{Equal, s})
+	}
+	x, y := a[pre:len(a)-suf], b[pre:len(b)-suf]
+	i, j := -1, -1
+	if len(x) > 0 && len(y) > 0 && len(x)+len(y) <= maxCompare {
+		i, j = middle(x, y)
+	}
+	if i < 0 {
+		for _, s := range x {
+			*ops = append(*ops, op{Delete, s})
+		}
+		for _, s := range y {
+			*ops = append(*ops, op{Insert, s})
+		}
+	} else {
+		edits(x[:i], y[:j], ops)
+		edits(x[i:], y[j:], ops)
+	}
+	for _, s := range a[len(a)-suf:] {
+		*ops = append(*ops, op{Equal, s})
+	}
+}
+
+// middle finds where a shortest edit script from a to b crosses the middle,
+// by searching forward from the start and backward from the end until the two
+// meet. It returns -1, -1 if a and b have nothing in common.
+func middle(a, b []string) (int, int) {
+	n, m := len(a), len(b)
+	maxD := (n + m + 1) / 2
+	off := maxD
+	// fwd[off+k] is the furthest x reached on diagonal k = x-y from the
+	// start; bwd the same from the end
+	fwd, bwd := make([]int, 2*maxD+2), make([]int, 2*maxD+2)
+	for i := range fwd {
+		fwd[i], bwd[i] = -1, -1
+	}
+	fwd[off+1], bwd[off+1] = 0, 0
+	delta := n - m
+	odd := delta%2 != 0
+	// diagonals that ran off the edges aren't worth extending
+	fStart, fEnd, bStart, bEnd := 0, 0, 0, 0
+	for d := 0; d < maxD; d++ {
+		for k := -d + fStart; k <= d-fEnd; k += 2 {
+			var x int
+			if k == -d || (k != d && fwd[off+k-1] < fwd[off+k+1]) {
+				x = fwd[off+k+1]
+			} else {
+				x = fwd[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			fwd[off+k] = x
+			switch {
+			case x > n:
+				fEnd += 2
+			case y > m:
+				fStart += 2
+			case odd:
+				if kb := off + delta - k; kb >= 0 && kb < len(bwd) && bwd[kb] != -1 && x >= n-bwd[kb] {
+					return x, y
+				}
+			}
+		}
+		for k := -d + bStart; k <= d-bEnd; k += 2 {
+			var x int
+			if k == -d || (k != d && bwd[off+k-1] < bwd[off+k+1]) {
+				x = bwd[off+k+1]
+			} else {
+				x = bwd[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[n-x-1] == b[m-y-1] {
+				x++
+				y++
+			}
+			bwd[off+k] = x
+			switch {
+			case x > n:
+				bEnd += 2
+			case y > m:
+				bStart += 2
+			case !odd:
+				if kf := off + delta - k; kf >= 0 && kf < len(fwd) && fwd[kf] != -1 {
+					fx := fwd[kf]
+					if fx >= n-x {
+						return fx, fx - (kf - off)
+					}
+				}
+			}
+		}
+	}
+	return -1, -1
+}
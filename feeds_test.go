@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"siteserver/content"
+)
+
+// rss is the part of an RSS 2.0 document the feeds fill in.
+type rss struct {
+	Channel struct {
+		Title string `xml:"title"`
+		Self  struct {
+			Href string `xml:"href,attr"`
+		} `xml:"http://www.w3.org/2005/Atom link"` // first, so it isn't read as Link
+		Link  string `xml:"link"`
+		Items []struct {
+			Title   string `xml:"title"`
+			Link    string `xml:"link"`
+			GUID    string `xml:"guid"`
+			PubDate string `xml:"pubDate"`
+		} `xml:"item"`
+	} `xml:"channel"`
+}
+
+func TestPostFeed(t *testing.T) {
+	ts := parseTemplates("views/")
+	published := time.Date(2024, 7, 3, 14, 30, 0, 0, time.FixedZone("EDT", -4*60*60))
+	feeds := map[string]postFeed{
+		"tag": {
+			Title: "Alex Shroyer: apl", Link: "/tags/apl", Self: "/tags/apl/rss.xml",
+		},
+		"series": {
+			Title: "Alex Shroyer: Arrays", Link: "/series/arrays", Self: "/series/arrays/rss.xml",
+		},
+	}
+	for name, feed := range feeds {
+		feed.SiteURL = "https://example.org"
+		feed.Items = []content.FeedPost{
+			{Link: "floatver", Title: "FloatVer & friends", Summary: "A versioning scheme.", Published: published},
+			{Link: "notes", Title: "Notes", Published: published.AddDate(0, -1, 0)},
+		}
+		var b strings.Builder
+		if err := ts["rss"].ExecuteTemplate(&b, "rss", feed); err != nil {
+			t.Fatal(err)
+		}
+		var doc rss
+		if err := xml.Unmarshal([]byte(b.String()), &doc); err != nil {
+			t.Fatalf("%s feed isn't XML: %v\n%s", name, err, b.String())
+		}
+		if doc.Channel.Link != "https://example.org"+feed.Link || doc.Channel.Self.Href != "https://example.org"+feed.Self {
+			t.Errorf("%s feed: channel link = %q, self = %q", name, doc.Channel.Link, doc.Channel.Self.Href)
+		}
+		if len(doc.Channel.Items) != 2 {
+			t.Fatalf("%s feed: %d items, want 2", name, len(doc.Channel.Items))
+		}
+		for i, item := range doc.Channel.Items {
+			want := feed.Items[i]
+			if link := "https://example.org/posts/" + want.Link; item.Link != link || item.GUID != link {
+				t.Errorf("%s feed item %d: link %q, guid %q, want %q", name, i, item.Link, item.GUID, link)
+			}
+			if item.Title != want.Title {
+				t.Errorf("%s feed item %d: title %q, want %q", name, i, item.Title, want.Title)
+			}
+			date, err := time.Parse(time.RFC1123Z, item.PubDate)
+			if err != nil {
+				t.Errorf("%s feed item %d: pubDate: %v", name, i, err)
+			} else if !date.Equal(want.Published) {
+				t.Errorf("%s feed item %d: pubDate %v, want %v", name, i, date, want.Published)
+			}
+		}
+	}
+}
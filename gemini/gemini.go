@@ -0,0 +1,190 @@
+// Package gemini is a small server for the Gemini protocol: one request line
+// over TLS, one status line back, then the body.
+// See gemini://geminiprotocol.net/docs/protocol-specification.gmi
+package gemini
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	StatusInput            = 10
+	StatusSuccess          = 20
+	StatusRedirect         = 30
+	StatusTemporaryFailure = 40
+	StatusNotFound         = 51
+	StatusProxyRefused     = 53
+	StatusBadRequest       = 59
+)
+
+// Request is what a client asked for.
+type Request struct {
+	URL        *url.URL
+	RemoteAddr string
+}
+
+// ResponseWriter sends a response. The status line goes out on the first
+// Write unless WriteHeader was called first, as 20 text/gemini.
+type ResponseWriter interface {
+	WriteHeader(status int, meta string)
+	Write([]byte) (int, error)
+}
+
+type Handler interface {
+	ServeGemini(ResponseWriter, *Request)
+}
+
+type HandlerFunc func(ResponseWriter, *Request)
+
+func (f HandlerFunc) ServeGemini(w ResponseWriter, r *Request) {
+	f(w, r)
+}
+
+// ServeMux routes requests by path. A pattern ending in "/" matches
+// everything under it; otherwise it matches that path only. The longest
+// matching pattern wins.
+type ServeMux struct {
+	routes map[string]Handler
+}
+
+func NewServeMux() *ServeMux {
+	return &ServeMux{routes: map[string]Handler{}}
+}
+
+func (m *ServeMux) HandleFunc(pattern string, f func(ResponseWriter, *Request)) {
+	m.routes[pattern] = HandlerFunc(f)
+}
+
+func (m *ServeMux) ServeGemini(w ResponseWriter, r *Request) {
+	path := r.URL.Path
+	if path == "" {
+		path = "/"
+	}
+	var best string
+	var h Handler
+	for pattern, handler := range m.routes {
+		match := pattern == path || (strings.HasSuffix(pattern, "/") && strings.HasPrefix(path, pattern))
+		if match && len(pattern) > len(best) {
+			best, h = pattern, handler
+		}
+	}
+	if h == nil {
+		NotFound(w)
+		return
+	}
+	h.ServeGemini(w, r)
+}
+
+func NotFound(w ResponseWriter) {
+	w.WriteHeader(StatusNotFound, "Not found")
+}
+
+type response struct {
+	w           io.Writer
+	wroteHeader bool
+}
+
+func (r *response) WriteHeader(status int, meta string) {
+	if r.wroteHeader {
+		return
+	}
+	r.wroteHeader = true
+	fmt.Fprintf(r.w, "%d %s\r\n", status, meta)
+}
+
+func (r *response) Write(b []byte) (int, error) {
+	r.WriteHeader(StatusSuccess, "text/gemini; charset=utf-8")
+	return r.w.Write(b)
+}
+
+// Server serves Gemini over TLS.
+type Server struct {
+	Addr     string // defaults to ":1965"
+	Hostname string // if set, requests for other hosts are refused
+	CertFile string // see LoadCertificate
+	KeyFile  string
+	Handler  Handler
+}
+
+func (s *Server) ListenAndServe() error {
+	cert, err := LoadCertificate(s.CertFile, s.KeyFile, s.Hostname)
+	if err != nil {
+		return err
+	}
+	addr := s.Addr
+	if addr == "" {
+		addr = ":1965"
+	}
+	ln, err := tls.Listen("tcp", addr, &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	})
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+// Serve answers requests on ln, which should already speak TLS.
+func (s *Server) Serve(ln net.Listener) error {
+	defer ln.Close()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				time.Sleep(50 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	w := &response{w: conn}
+
+	// the request is an absolute URL of at most 1024 bytes, then CRLF
+	line, err := bufio.NewReaderSize(io.LimitReader(conn, 1026), 1026).ReadString('\n')
+	if err != nil {
+		w.WriteHeader(StatusBadRequest, "Bad request")
+		return
+	}
+	line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+	u, err := url.Parse(line)
+	if err != nil || len(line) > 1024 || u.Host == "" || u.User != nil || u.Fragment != "" {
+		w.WriteHeader(StatusBadRequest, "Bad request")
+		return
+	}
+	if u.Scheme != "gemini" || (s.Hostname != "" && !strings.EqualFold(u.Hostname(), s.Hostname)) {
+		w.WriteHeader(StatusProxyRefused, "Proxy request refused")
+		return
+	}
+	if u.Path == "" {
+		u.Path = "/"
+		w.WriteHeader(StatusRedirect, u.String())
+		return
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			log.Printf("[gemini] %s: %v", line, err)
+			w.WriteHeader(StatusTemporaryFailure, "Internal error")
+		}
+	}()
+	s.Handler.ServeGemini(w, &Request{URL: u, RemoteAddr: conn.RemoteAddr().String()})
+	if !w.wroteHeader {
+		NotFound(w)
+	}
+}
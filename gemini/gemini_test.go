@@ -0,0 +1,172 @@
+package gemini
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// serve starts s on a loopback port with cert and returns its address.
+func serve(t *testing.T, s *Server, cert tls.Certificate) string {
+	t.Helper()
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(ln)
+	t.Cleanup(func() { ln.Close() })
+	return ln.Addr().String()
+}
+
+// fetch sends one request line and returns the status line, the body and
+// the certificate the server presented.
+func fetch(t *testing.T, addr, request string) (header, body string, cert *x509.Certificate) {
+	t.Helper()
+	// trust on first use: there is no CA to check against
+	conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := io.WriteString(conn, request); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, body, _ = strings.Cut(string(resp), "\r\n")
+	return header, body, conn.ConnectionState().PeerCertificates[0]
+}
+
+func TestServe(t *testing.T) {
+	cert, err := LoadCertificate("", "", "localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := NewServeMux()
+	mux.HandleFunc("/", func(w ResponseWriter, r *Request) {
+		if r.URL.Path != "/" {
+			NotFound(w)
+			return
+		}
+		fmt.Fprint(w, "# Home\n")
+	})
+	mux.HandleFunc("/posts/", func(w ResponseWriter, r *Request) {
+		fmt.Fprintf(w, "post %s\n", strings.TrimPrefix(r.URL.Path, "/posts/"))
+	})
+	mux.HandleFunc("/posts/pinned", func(w ResponseWriter, r *Request) {
+		fmt.Fprint(w, "pinned\n")
+	})
+	mux.HandleFunc("/silent", func(w ResponseWriter, r *Request) {})
+	mux.HandleFunc("/panic", func(w ResponseWriter, r *Request) { panic("boom") })
+	mux.HandleFunc("/pdf", func(w ResponseWriter, r *Request) {
+		w.WriteHeader(StatusSuccess, "application/pdf")
+		w.Write([]byte("%PDF"))
+	})
+	addr := serve(t, &Server{Hostname: "localhost", Handler: mux}, cert)
+
+	tests := []struct {
+		request string
+		header  string
+		body    string
+	}{
+		{"gemini://localhost/\r\n", "20 text/gemini; charset=utf-8", "# Home\n"},
+		{"gemini://LOCALHOST:1965/\r\n", "20 text/gemini; charset=utf-8", "# Home\n"},
+		{"gemini://localhost/\n", "20 text/gemini; charset=utf-8", "# Home\n"},
+		{"gemini://localhost/posts/floatver\r\n", "20 text/gemini; charset=utf-8", "post floatver\n"},
+		{"gemini://localhost/posts/pinned\r\n", "20 text/gemini; charset=utf-8", "pinned\n"},
+		{"gemini://localhost/pdf\r\n", "20 application/pdf", "%PDF"},
+		{"gemini://localhost\r\n", "30 gemini://localhost/", ""},
+		{"gemini://localhost/missing\r\n", "51 Not found", ""},
+		{"gemini://localhost/silent\r\n", "51 Not found", ""},
+		{"gemini://localhost/panic\r\n", "40 Internal error", ""},
+		{"https://localhost/\r\n", "53 Proxy request refused", ""},
+		{"gemini://example.com/\r\n", "53 Proxy request refused", ""},
+		{"/relative\r\n", "59 Bad request", ""},
+		{"gemini://user@localhost/\r\n", "59 Bad request", ""},
+		{"gemini://localhost/#top\r\n", "59 Bad request", ""},
+		{"gemini://localhost/" + strings.Repeat("a", 1024) + "\r\n", "59 Bad request", ""},
+		{"gemini://localhost/", "59 Bad request", ""}, // no line ending
+	}
+	for _, tt := range tests {
+		header, body, _ := fetch(t, addr, tt.request)
+		if header != tt.header || body != tt.body {
+			t.Errorf("%q: got %q %q, want %q %q", tt.request, header, body, tt.header, tt.body)
+		}
+	}
+}
+
+func TestServeAnyHost(t *testing.T) {
+	cert, err := LoadCertificate("", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := NewServeMux()
+	mux.HandleFunc("/", func(w ResponseWriter, r *Request) { fmt.Fprint(w, r.URL.Host) })
+	addr := serve(t, &Server{Handler: mux}, cert)
+	if header, body, _ := fetch(t, addr, "gemini://example.com/\r\n"); header != "20 text/gemini; charset=utf-8" || body != "example.com" {
+		t.Errorf("with no Hostname: got %q %q, want any host served", header, body)
+	}
+}
+
+func TestLoadCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "gemini.crt"), filepath.Join(dir, "gemini.key")
+
+	first, err := LoadCertificate(certFile, keyFile, "capsule.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(first.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := leaf.VerifyHostname("capsule.example"); err != nil {
+		t.Errorf("generated certificate: %v", err)
+	}
+	info, err := os.Stat(keyFile)
+	if err != nil {
+		t.Fatalf("key wasn't saved: %v", err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("key file mode = %v, want 0600", mode)
+	}
+
+	// a restart must present the same certificate, or TOFU clients complain
+	again, err := LoadCertificate(certFile, keyFile, "capsule.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again.Certificate[0], first.Certificate[0]) {
+		t.Error("LoadCertificate made a new certificate when one was saved")
+	}
+	mux := NewServeMux()
+	mux.HandleFunc("/", func(w ResponseWriter, r *Request) { fmt.Fprint(w, "hi") })
+	addr := serve(t, &Server{Handler: mux}, again)
+	for range 2 {
+		if _, _, got := fetch(t, addr, "gemini://capsule.example/\r\n"); !bytes.Equal(got.Raw, first.Certificate[0]) {
+			t.Error("server presented a different certificate than the saved one")
+		}
+	}
+
+	// a broken pair is an error, not a reason to replace it
+	if err := os.WriteFile(certFile, []byte("junk"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadCertificate(certFile, keyFile, "capsule.example"); err == nil {
+		t.Error("LoadCertificate accepted a corrupt certificate")
+	}
+}
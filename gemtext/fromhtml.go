@@ -0,0 +1,378 @@
+package gemtext
+
+import (
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// FromHTML converts an HTML page or fragment to gemtext. Gemtext has no
+// inline links, so the links in a paragraph (or list, or quote) follow it
+// as => lines. Code and tables become preformatted blocks. Relative links
+// are resolved against base, if it isn't nil.
+func FromHTML(r io.Reader, base *url.URL) (Document, error) {
+	root, err := html.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	c := &converter{base: base}
+	c.walk(root)
+	c.flush()
+	c.links()
+	for len(c.doc) > 0 && c.doc[len(c.doc)-1].Kind == Text && c.doc[len(c.doc)-1].Text == "" {
+		c.doc = c.doc[:len(c.doc)-1]
+	}
+	return c.doc, nil
+}
+
+type frame struct {
+	kind    Kind
+	ordered bool
+	items   int
+}
+
+type converter struct {
+	base    *url.URL
+	doc     Document
+	text    strings.Builder // the block being collected; "\n" marks a <br>
+	pending []Line          // links waiting for the end of their block
+	stack   []frame
+}
+
+func (c *converter) kind() Kind {
+	if len(c.stack) == 0 {
+		return Text
+	}
+	return c.stack[len(c.stack)-1].kind
+}
+
+// atTop says whether we're outside any list or quote, where links and blank
+// lines can go without breaking anything up.
+func (c *converter) atTop() bool {
+	for _, f := range c.stack {
+		if f.kind == ListItem || f.kind == Quote {
+			return false
+		}
+	}
+	return true
+}
+
+// flush ends the text collected so far as lines of the current kind.
+func (c *converter) flush() {
+	kind := c.kind()
+	lines := strings.Split(c.text.String(), "\n")
+	c.text.Reset()
+	if kind == Heading1 || kind == Heading2 || kind == Heading3 {
+		lines = []string{strings.Join(lines, " ")}
+	}
+	wrote := false
+	for _, l := range lines {
+		if l = strings.Join(strings.Fields(l), " "); l != "" {
+			if kind == Text {
+				l = plain(l)
+			}
+			c.doc = append(c.doc, Line{Kind: kind, Text: l})
+			wrote = true
+		}
+	}
+	if wrote && c.atTop() {
+		c.links()
+	}
+}
+
+// links writes out the pending links and leaves a blank line.
+func (c *converter) links() {
+	c.doc = append(c.doc, c.pending...)
+	c.pending = nil
+	c.gap()
+}
+
+func (c *converter) gap() {
+	if n := len(c.doc); n > 0 && !(c.doc[n-1].Kind == Text && c.doc[n-1].Text == "") {
+		c.doc = append(c.doc, Line{Kind: Text})
+	}
+}
+
+func (c *converter) push(f frame) {
+	c.flush()
+	c.stack = append(c.stack, f)
+}
+
+func (c *converter) pop() {
+	c.flush()
+	c.stack = c.stack[:len(c.stack)-1]
+	if c.atTop() {
+		c.links()
+	}
+}
+
+func (c *converter) link(href, text string) {
+	if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(strings.ToLower(href), "javascript:") {
+		return
+	}
+	if c.base != nil {
+		if u, err := c.base.Parse(href); err == nil {
+			href = u.String()
+		}
+	}
+	c.pending = append(c.pending, Line{Kind: Link, URL: href, Text: strings.Join(strings.Fields(text), " ")})
+}
+
+func (c *converter) walk(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		c.text.WriteString(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		c.children(n)
+		return
+	}
+
+	switch n.Data {
+	case "head", "script", "style", "noscript", "template":
+	case "br":
+		c.text.WriteByte('\n')
+	case "a":
+		if hasClass(n, "footnote-backref") {
+			return
+		}
+		c.children(n)
+		c.link(attr(n, "href"), textContent(n))
+	case "img":
+		alt := attr(n, "alt")
+		if alt == "" {
+			alt = "image"
+		}
+		c.link(attr(n, "src"), alt)
+	case "sup":
+		// footnote references: "word[1]" rather than "word1"
+		if a := findTag(n, "a"); a != nil && strings.HasPrefix(attr(a, "href"), "#") {
+			c.text.WriteString("[" + strings.TrimSpace(textContent(n)) + "]")
+			return
+		}
+		c.children(n)
+	case "h1":
+		c.heading(n, Heading1)
+	case "h2":
+		c.heading(n, Heading2)
+	case "h3", "h4", "h5", "h6":
+		c.heading(n, Heading3)
+	case "ul", "ol", "dl":
+		c.push(frame{kind: ListItem, ordered: n.Data == "ol"})
+		c.children(n)
+		c.pop()
+	case "li":
+		f := frame{kind: ListItem}
+		if len(c.stack) > 0 && c.stack[len(c.stack)-1].ordered {
+			c.stack[len(c.stack)-1].items++
+			f.items = c.stack[len(c.stack)-1].items
+		}
+		c.push(f)
+		if f.items > 0 {
+			c.text.WriteString(strconv.Itoa(f.items) + ". ")
+		}
+		c.children(n)
+		c.pop()
+	case "blockquote":
+		c.push(frame{kind: Quote})
+		c.children(n)
+		c.pop()
+	case "pre":
+		c.flush()
+		c.doc = append(c.doc, Line{Kind: Preformatted, Text: verbatim(strings.Trim(textContent(n), "\n")), Alt: language(n)})
+		if c.atTop() {
+			c.gap()
+		}
+	case "table":
+		c.flush()
+		c.table(n)
+		if c.atTop() {
+			c.links()
+		}
+	case "hr":
+		c.flush()
+		c.doc = append(c.doc, Line{Kind: Text, Text: "-----"})
+		if c.atTop() {
+			c.gap()
+		}
+	case "p", "div", "section", "article", "main", "header", "footer", "nav", "aside",
+		"figure", "figcaption", "dt", "dd", "details", "summary", "address", "center":
+		c.flush()
+		c.children(n)
+		c.flush()
+	default:
+		c.children(n)
+	}
+}
+
+func (c *converter) children(n *html.Node) {
+	for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+		c.walk(ch)
+	}
+}
+
+func (c *converter) heading(n *html.Node, kind Kind) {
+	c.push(frame{kind: kind})
+	c.children(n)
+	c.pop()
+}
+
+// table lays a table out as columns of text.
+func (c *converter) table(n *html.Node) {
+	var rows [][]string
+	header := false
+	caption := ""
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "caption":
+				caption = strings.Join(strings.Fields(textContent(n)), " ")
+				return
+			case "tr":
+				var row []string
+				for cell := n.FirstChild; cell != nil; cell = cell.NextSibling {
+					if cell.Type == html.ElementNode && (cell.Data == "td" || cell.Data == "th") {
+						row = append(row, strings.Join(strings.Fields(textContent(cell)), " "))
+						header = header || (len(rows) == 0 && cell.Data == "th")
+					}
+				}
+				rows = append(rows, row)
+			case "a":
+				c.link(attr(n, "href"), textContent(n))
+			}
+		}
+		for ch := n.FirstChild; ch != nil; ch = ch.NextSibling {
+			walk(ch)
+		}
+	}
+	walk(n)
+	if len(rows) == 0 {
+		return
+	}
+
+	var widths []int
+	for _, row := range rows {
+		for i, cell := range row {
+			if i == len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[i] = max(widths[i], utf8.RuneCountInString(cell))
+		}
+	}
+	var lines []string
+	for r, row := range rows {
+		cells := make([]string, len(widths))
+		for i := range widths {
+			cell := ""
+			if i < len(row) {
+				cell = row[i]
+			}
+			cells[i] = cell + strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell))
+		}
+		lines = append(lines, strings.TrimRight(strings.Join(cells, " | "), " "))
+		if r == 0 && header && len(rows) > 1 {
+			rule := make([]string, len(widths))
+			for i, w := range widths {
+				rule[i] = strings.Repeat("-", w)
+			}
+			lines = append(lines, strings.Join(rule, "-+-"))
+		}
+	}
+	if caption != "" {
+		c.doc = append(c.doc, Line{Kind: Text, Text: plain(caption)})
+	}
+	c.doc = append(c.doc, Line{Kind: Preformatted, Text: verbatim(strings.Join(lines, "\n")), Alt: "table"})
+}
+
+// zeroWidth goes in front of text that would otherwise be read as markup. It
+// doesn't show, and a gemtext line's type is decided by its first characters.
+const zeroWidth = "\u200b"
+
+// plain keeps a line of text from being read as a link, heading, list item,
+// quote or the edge of a preformatted block.
+func plain(line string) string {
+	for _, marker := range []string{"=>", "*", "#", ">", "```"} {
+		if strings.HasPrefix(line, marker) {
+			return zeroWidth + line
+		}
+	}
+	return line
+}
+
+// verbatim keeps the lines of a preformatted block from ending it early.
+func verbatim(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, l := range lines {
+		if strings.HasPrefix(l, "```") {
+			lines[i] = zeroWidth + l
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// language finds a code block's language in class="src src-go" (Org) or
+// class="language-go" (Markdown), on the <pre> or a <code> inside it.
+func language(pre *html.Node) string {
+	nodes := []*html.Node{pre}
+	if code := findTag(pre, "code"); code != nil {
+		nodes = append(nodes, code)
+	}
+	for _, n := range nodes {
+		for _, class := range strings.Fields(attr(n, "class")) {
+			if lang, ok := strings.CutPrefix(class, "src-"); ok {
+				return lang
+			}
+			if lang, ok := strings.CutPrefix(class, "language-"); ok {
+				return lang
+			}
+		}
+	}
+	return ""
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasClass(n *html.Node, class string) bool {
+	for _, c := range strings.Fields(attr(n, "class")) {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+func findTag(n *html.Node, tag string) *html.Node {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && c.Data == tag {
+			return c
+		}
+		if found := findTag(c, tag); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(textContent(c))
+	}
+	return b.String()
+}
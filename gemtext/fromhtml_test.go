@@ -0,0 +1,43 @@
+package gemtext
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFromHTMLEscapesMarkers(t *testing.T) {
+	tests := []struct {
+		html string
+		want Document // after a trip through String and Parse
+	}{
+		{`<p>=&gt; gemini://evil.example Click</p>`, Document{{Kind: Text, Text: zeroWidth + "=> gemini://evil.example Click"}}},
+		{`<p>*not* a list</p>`, Document{{Kind: Text, Text: zeroWidth + "*not* a list"}}},
+		{`<p>#hashtag</p>`, Document{{Kind: Text, Text: zeroWidth + "#hashtag"}}},
+		{`<p>&gt; not a quote</p>`, Document{{Kind: Text, Text: zeroWidth + "> not a quote"}}},
+		{"<p>```</p><p>still text</p>", Document{{Kind: Text, Text: zeroWidth + "```"}, {Kind: Text}, {Kind: Text, Text: "still text"}}},
+		{`<p>one<br>#two</p>`, Document{{Kind: Text, Text: "one"}, {Kind: Text, Text: zeroWidth + "#two"}}},
+		{`<p>a => b</p>`, Document{{Kind: Text, Text: "a => b"}}},
+		{"<pre>```go\nfmt.Println()\n```</pre><p>after</p>", Document{
+			{Kind: Preformatted, Text: zeroWidth + "```go\nfmt.Println()\n" + zeroWidth + "```"},
+			{Kind: Text},
+			{Kind: Text, Text: "after"},
+		}},
+		{"<table><tr><td>```</td></tr></table>", Document{{Kind: Preformatted, Alt: "table", Text: zeroWidth + "```"}}},
+	}
+	for _, tt := range tests {
+		doc, err := FromHTML(strings.NewReader(tt.html), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := Parse([]byte(doc.String()))
+		if len(got) != len(tt.want) {
+			t.Errorf("%s:\ngot  %+v\nwant %+v", tt.html, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: line %d = %+v, want %+v", tt.html, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
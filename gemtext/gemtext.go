@@ -0,0 +1,129 @@
+// Package gemtext parses and writes text/gemini, the Gemini protocol's
+// line-oriented markup, and renders it to HTML.
+package gemtext
+
+import (
+	"strings"
+)
+
+type Kind int
+
+const (
+	Text Kind = iota
+	Link
+	Heading1
+	Heading2
+	Heading3
+	ListItem
+	Quote
+	Preformatted
+)
+
+// Line is one line of a document, except that a whole preformatted block,
+// toggle lines and all, is a single Line.
+type Line struct {
+	Kind Kind
+	Text string // the text with its line-type prefix removed, a link's name, or a block's lines
+	URL  string // where a link goes, as written
+	Alt  string // the alt text after a block's opening ```
+}
+
+// Document is parsed gemtext.
+type Document []Line
+
+// Parse reads gemtext. Anything is valid gemtext, so it can't fail; an
+// unclosed preformatted block runs to the end of the document.
+func Parse(src []byte) Document {
+	text := strings.ReplaceAll(string(src), "\r\n", "\n")
+	if text == "" {
+		return nil
+	}
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	var doc Document
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if strings.HasPrefix(line, "```") {
+			block := Line{Kind: Preformatted, Alt: strings.TrimSpace(line[3:])}
+			var pre []string
+			for i++; i < len(lines) && !strings.HasPrefix(lines[i], "```"); i++ {
+				pre = append(pre, lines[i])
+			}
+			block.Text = strings.Join(pre, "\n")
+			doc = append(doc, block)
+			continue
+		}
+		doc = append(doc, parseLine(line))
+	}
+	return doc
+}
+
+func parseLine(line string) Line {
+	switch {
+	case strings.HasPrefix(line, "=>"):
+		rest := strings.TrimLeft(line[2:], " \t")
+		end := strings.IndexAny(rest, " \t")
+		if end < 0 {
+			end = len(rest)
+		}
+		if end == 0 {
+			break // no URL, so just text
+		}
+		return Line{Kind: Link, URL: rest[:end], Text: strings.TrimSpace(rest[end:])}
+	case strings.HasPrefix(line, "###"):
+		return Line{Kind: Heading3, Text: strings.TrimSpace(line[3:])}
+	case strings.HasPrefix(line, "##"):
+		return Line{Kind: Heading2, Text: strings.TrimSpace(line[2:])}
+	case strings.HasPrefix(line, "#"):
+		return Line{Kind: Heading1, Text: strings.TrimSpace(line[1:])}
+	case strings.HasPrefix(line, "* "):
+		return Line{Kind: ListItem, Text: strings.TrimSpace(line[2:])}
+	case strings.HasPrefix(line, ">"):
+		return Line{Kind: Quote, Text: strings.TrimSpace(line[1:])}
+	}
+	return Line{Kind: Text, Text: line}
+}
+
+// Title is the text of the first top-level heading, which by convention is
+// the document's title.
+func (d Document) Title() string {
+	for _, l := range d {
+		if l.Kind == Heading1 {
+			return l.Text
+		}
+	}
+	return ""
+}
+
+// String writes the document back out as gemtext.
+func (d Document) String() string {
+	var b strings.Builder
+	for _, l := range d {
+		switch l.Kind {
+		case Text:
+			b.WriteString(l.Text)
+		case Link:
+			b.WriteString("=> " + l.URL)
+			if l.Text != "" {
+				b.WriteString(" " + l.Text)
+			}
+		case Heading1:
+			b.WriteString("# " + l.Text)
+		case Heading2:
+			b.WriteString("## " + l.Text)
+		case Heading3:
+			b.WriteString("### " + l.Text)
+		case ListItem:
+			b.WriteString("* " + l.Text)
+		case Quote:
+			b.WriteString("> " + l.Text)
+		case Preformatted:
+			b.WriteString("```" + l.Alt + "\n")
+			if l.Text != "" {
+				b.WriteString(l.Text + "\n")
+			}
+			b.WriteString("```")
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
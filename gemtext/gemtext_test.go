@@ -0,0 +1,104 @@
+package gemtext
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		src  string
+		want Document
+	}{
+		{"", nil},
+		{"plain text\n", Document{{Kind: Text, Text: "plain text"}}},
+		{"no final newline", Document{{Kind: Text, Text: "no final newline"}}},
+		{"one\r\n\r\ntwo\r\n", Document{{Kind: Text, Text: "one"}, {Kind: Text}, {Kind: Text, Text: "two"}}},
+		{"=> gemini://example.org/ A capsule", Document{{Kind: Link, URL: "gemini://example.org/", Text: "A capsule"}}},
+		{"=>/posts/\tAll  posts ", Document{{Kind: Link, URL: "/posts/", Text: "All  posts"}}},
+		{"=> https://example.org", Document{{Kind: Link, URL: "https://example.org"}}},
+		{"=>", Document{{Kind: Text, Text: "=>"}}},
+		{"=>   ", Document{{Kind: Text, Text: "=>   "}}},
+		{"# Title", Document{{Kind: Heading1, Text: "Title"}}},
+		{"##Section", Document{{Kind: Heading2, Text: "Section"}}},
+		{"###  Sub ", Document{{Kind: Heading3, Text: "Sub"}}},
+		{"#### Deeper", Document{{Kind: Heading3, Text: "# Deeper"}}},
+		{"* item", Document{{Kind: ListItem, Text: "item"}}},
+		{"*not a list", Document{{Kind: Text, Text: "*not a list"}}},
+		{">quoted", Document{{Kind: Quote, Text: "quoted"}}},
+		{"> ", Document{{Kind: Quote}}},
+		{"```go\nfmt.Println()\n\n# not a heading\n```\nafter", Document{
+			{Kind: Preformatted, Alt: "go", Text: "fmt.Println()\n\n# not a heading"},
+			{Kind: Text, Text: "after"},
+		}},
+		{"``` \n```", Document{{Kind: Preformatted}}},
+		{"```\nunclosed\n=> /x", Document{{Kind: Preformatted, Text: "unclosed\n=> /x"}}},
+		{"```a\n```b\n```", Document{{Kind: Preformatted, Alt: "a"}, {Kind: Preformatted}}},
+	}
+	for _, tt := range tests {
+		if got := Parse([]byte(tt.src)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%q):\ngot  %+v\nwant %+v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestHTML(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"a <b> & \"c\"", "<p>a &lt;b&gt; &amp; &quot;c&quot;</p>\n"},
+		{"=> /posts/?a=1&b=2 Posts", `<p class="link"><a href="/posts/?a=1&amp;b=2">Posts</a></p>` + "\n"},
+		{"=> gemini://example.org/", `<p class="link"><a href="gemini://example.org/">gemini://example.org/</a></p>` + "\n"},
+		{"# One\n## Two\n### Three", "<h1>One</h1>\n<h2>Two</h2>\n<h3>Three</h3>\n"},
+		{"* a\n* b\ntext\n* c", "<ul>\n<li>a</li>\n<li>b</li>\n</ul>\n<p>text</p>\n<ul>\n<li>c</li>\n</ul>\n"},
+		{"> a\n> b", "<blockquote>a<br>\nb</blockquote>\n"},
+		{"one\n\ntwo\n\n\n\nthree", "<p>one</p>\n<p>two</p>\n<br>\n<br>\n<p>three</p>\n"},
+		{"```\n<x>\n```", "<pre>&lt;x&gt;</pre>\n"},
+		{"```a \"diagram\"\n+--+\n```", "<figure>\n" +
+			`<pre aria-label="a &quot;diagram&quot;">+--+</pre>` + "\n" +
+			"<figcaption>a &quot;diagram&quot;</figcaption>\n</figure>\n"},
+	}
+	for _, tt := range tests {
+		if got := string(Parse([]byte(tt.src)).HTML()); got != tt.want {
+			t.Errorf("HTML of %q:\ngot  %q\nwant %q", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	doc := Document{
+		{Kind: Heading1, Text: "Title"},
+		{Kind: Text},
+		{Kind: Link, URL: "/posts/", Text: "All posts"},
+		{Kind: Link, URL: "gemini://example.org/"},
+		{Kind: Heading2, Text: "Two"},
+		{Kind: Heading3, Text: "Three"},
+		{Kind: ListItem, Text: "item"},
+		{Kind: Quote, Text: "quoted"},
+		{Kind: Preformatted, Alt: "go", Text: "fmt.Println()"},
+		{Kind: Preformatted},
+	}
+	want := "# Title\n\n=> /posts/ All posts\n=> gemini://example.org/\n## Two\n### Three\n* item\n> quoted\n" +
+		"```go\nfmt.Println()\n```\n```\n```\n"
+	if got := doc.String(); got != want {
+		t.Errorf("String:\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, src := range []string{
+		"# Notes\n\nSome text.\n=> gemini://example.org/ A capsule\n=> /bare\n",
+		"## Two\n### Three\n* a\n* b\n> quote\n> more\n",
+		"```ascii art\n  /\\\n /  \\\n\n```\nafter\n",
+		"```\n```\n",
+	} {
+		doc := Parse([]byte(src))
+		if got := doc.String(); got != src {
+			t.Errorf("String(Parse(%q)) = %q", src, got)
+		}
+		if again := Parse([]byte(doc.String())); !reflect.DeepEqual(again, doc) {
+			t.Errorf("%q changed on a second trip:\ngot  %+v\nwant %+v", src, again, doc)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package gemtext
+
+import (
+	"strings"
+)
+
+var escaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+// HTML renders the document. Each text line is a paragraph, so one blank line
+// between them is already accounted for by the paragraph spacing; any more
+// than that become <br>s.
+func (d Document) HTML() []byte {
+	var b strings.Builder
+	blank := 0
+	for i := 0; i < len(d); i++ {
+		l := d[i]
+		if l.Kind == Text && strings.TrimSpace(l.Text) == "" {
+			if blank++; blank > 1 {
+				b.WriteString("<br>\n")
+			}
+			continue
+		}
+		blank = 0
+		switch l.Kind {
+		case Text:
+			b.WriteString("<p>" + escape(l.Text) + "</p>\n")
+		case Link:
+			name := l.Text
+			if name == "" {
+				name = l.URL
+			}
+			b.WriteString(`<p class="link"><a href="` + escape(l.URL) + `">` + escape(name) + "</a></p>\n")
+		case Heading1:
+			b.WriteString("<h1>" + escape(l.Text) + "</h1>\n")
+		case Heading2:
+			b.WriteString("<h2>" + escape(l.Text) + "</h2>\n")
+		case Heading3:
+			b.WriteString("<h3>" + escape(l.Text) + "</h3>\n")
+		case ListItem:
+			b.WriteString("<ul>\n")
+			for ; i < len(d) && d[i].Kind == ListItem; i++ {
+				b.WriteString("<li>" + escape(d[i].Text) + "</li>\n")
+			}
+			i--
+			b.WriteString("</ul>\n")
+		case Quote:
+			var quote []string
+			for ; i < len(d) && d[i].Kind == Quote; i++ {
+				quote = append(quote, escape(d[i].Text))
+			}
+			i--
+			b.WriteString("<blockquote>" + strings.Join(quote, "<br>\n") + "</blockquote>\n")
+		case Preformatted:
+			if l.Alt == "" {
+				b.WriteString("<pre>" + escape(l.Text) + "</pre>\n")
+				break
+			}
+			alt := escape(l.Alt)
+			b.WriteString("<figure>\n")
+			b.WriteString(`<pre aria-label="` + alt + `">` + escape(l.Text) + "</pre>\n")
+			b.WriteString("<figcaption>" + alt + "</figcaption>\n")
+			b.WriteString("</figure>\n")
+		}
+	}
+	return []byte(b.String())
+}
@@ -0,0 +1,58 @@
+package live
+
+import (
+	"sync"
+)
+
+// Hub fans out messages to everyone watching a topic (e.g. a post's link).
+// It's in-process only, so each server instance has its own set of listeners.
+type Hub struct {
+	mu   sync.Mutex
+	subs map[string]map[*Subscriber]struct{}
+}
+
+type Subscriber struct {
+	C     chan []byte
+	topic string
+	owner string // session token, so a commenter doesn't get their own comment twice
+}
+
+func NewHub() *Hub {
+	return &Hub{subs: map[string]map[*Subscriber]struct{}{}}
+}
+
+func (h *Hub) Subscribe(topic, owner string) *Subscriber {
+	s := &Subscriber{C: make(chan []byte, 16), topic: topic, owner: owner}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs[topic] == nil {
+		h.subs[topic] = map[*Subscriber]struct{}{}
+	}
+	h.subs[topic][s] = struct{}{}
+	return s
+}
+
+func (h *Hub) Unsubscribe(s *Subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subs[s.topic], s)
+	if len(h.subs[s.topic]) == 0 {
+		delete(h.subs, s.topic)
+	}
+}
+
+// Publish sends msg to every subscriber of topic except those owned by skip.
+// Slow subscribers miss messages rather than blocking the publisher.
+func (h *Hub) Publish(topic string, msg []byte, skip string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.subs[topic] {
+		if skip != "" && s.owner == skip {
+			continue
+		}
+		select {
+		case s.C <- msg:
+		default:
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package live
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// WriteEvent writes one Server-Sent Event. Every line of data gets its own
+// "data:" field, since a bare newline would end the event early.
+func WriteEvent(w io.Writer, event string, data []byte) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "event: %s\n", event)
+	for _, line := range bytes.Split(bytes.TrimRight(data, "\n"), []byte("\n")) {
+		fmt.Fprintf(&buf, "data: %s\n", line)
+	}
+	buf.WriteString("\n")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
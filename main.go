@@ -1,21 +1,35 @@
 package main
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"html/template"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"net/mail"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
 
 	// local pacakges
 	"siteserver/content"
+	"siteserver/diff"
+	"siteserver/gemini"
+	"siteserver/live"
+	"siteserver/notify"
+	"siteserver/rewrite"
 	"siteserver/users"
+	"siteserver/webmention"
 
 	// third party
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type Site struct {
@@ -24,28 +38,75 @@ type Site struct {
 	Content any
 	Profile string
 	Thumbs  []content.Thumbnail
+	Drafts  []content.Thumbnail // the logged-in author's unpublished posts
+	After   string              // cursor Thumbs start after, when paging
+	Next    string              // cursor for the page after Thumbs, if there is one
+	Meta    *content.Meta       // link preview and search engine metadata, for public pages
 }
 
+type postFeed struct {
+	SiteURL string
+	Title   string
+	Summary string
+	Link    string // relative to SiteURL
+	Self    string
+	Items   []content.FeedPost
+}
+
+type commentFeed struct {
+	SiteURL string
+	Title   string
+	Summary string
+	Link    string // relative to SiteURL
+	Self    string
+	Items   []content.FeedComment
+}
+
+type adminQueue struct {
+	Pending   []content.PendingComment
+	Reports   []content.Report
+	Sanctions []users.Sanction
+}
+
+// postsPerPage is how many cards /posts shows at a time.
+const postsPerPage = 12
+
 type session struct {
 	username string
 	expires  time.Time
 }
 
 // TODO: replace globals
-var sessions = map[string]session{}
+var (
+	sessions   = map[string]session{}
+	sessionsMu sync.Mutex // handlers run concurrently
+)
 
 func (s *session) isExpired() bool {
 	return s.expires.Before(time.Now())
 }
 
 func validSession(token string) (session, bool) {
+	sessionsMu.Lock()
 	data, ok := sessions[token] // TODO: replace globals
+	sessionsMu.Unlock()
 	if ok && !data.isExpired() {
 		return data, ok
 	}
 	return session{}, false
 }
 
+// endSessions logs username out everywhere.
+func endSessions(username string) {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	for token, s := range sessions { // TODO: replace globals
+		if s.username == username {
+			delete(sessions, token)
+		}
+	}
+}
+
 func getSession(r *http.Request) (session, bool) {
 	cookie, err := r.Cookie("session_token")
 	if err == nil {
@@ -63,7 +124,37 @@ func main() {
 	}
 	defer pool.Close()
 
+	cfg := loadConfig()
 	var ts Templates = parseTemplates("views/")
+	hub := live.NewHub()
+	notifier := notify.New(pool, &cfg.Mail, "views/email.txt", cfg.SiteURL)
+	mentions := webmention.NewClient()
+	go func() {
+		for range time.Tick(time.Minute) {
+			n, err := content.PublishScheduled(pool)
+			if err != nil {
+				log.Print("content.PublishScheduled: ", err)
+			} else if n > 0 {
+				log.Printf("published %d scheduled post(s)", n)
+			}
+		}
+	}()
+
+	// post bodies live in the database, or failing that on disk
+	bodies := content.Sources{
+		content.DBSource{Pool: pool},
+		content.DirSource{Dir: "./public/posts", Formats: []string{"html", "md", "org", "gmi"}},
+	}
+
+	// post bodies are touched up on the way out, see rewrite
+	siteURL, _ := url.Parse(cfg.SiteURL)
+	rewriter := rewrite.New(
+		rewrite.ReadingTime, // before anchors add their "#"
+		rewrite.HeadingAnchors,
+		rewrite.Images(map[string]string{"/images/": "./static/images", "/s/": "./static"}),
+		rewrite.ExternalLinks(siteURL.Hostname()),
+	)
+	meta := content.MetaSite{URL: strings.TrimSuffix(cfg.SiteURL, "/"), Name: "Alex Shroyer", Image: cfg.SiteImage}
 
 	fileServer := http.FileServer(http.Dir("./static")) // "/static" (on local fs)
 	imageServer := http.FileServer(http.Dir("./static/images"))
@@ -84,6 +175,52 @@ func main() {
 		if sess, ok := getSession(r); ok {
 			data.Profile = sess.username
 		}
+		if !data.Visible(data.Profile) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if data.Profile == "" {
+			if !cfg.GuestComments {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			name := strings.TrimSpace(r.PostFormValue("guest_name"))
+			email := strings.TrimSpace(r.PostFormValue("guest_email"))
+			taken, err := users.NameTaken(pool, name)
+			if err != nil {
+				log.Print("users.NameTaken: ", err)
+				return
+			}
+			problem := ""
+			if name == "" || len(name) > 50 || strings.IndexFunc(name, unicode.IsControl) >= 0 {
+				problem = "Please enter a name (up to 50 characters, on one line)."
+			} else if _, err := mail.ParseAddress(email); err != nil || len(email) > 254 {
+				problem = "Please enter a valid email address."
+			} else if taken {
+				problem = "That name belongs to a registered user, please pick another."
+			}
+			if problem != "" {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				assert(ts["post"].ExecuteTemplate(w, "comment-error", problem))
+				return
+			}
+			id, err := content.PostGuestComment(pool, data.ID, name, email, comment)
+			if err != nil {
+				log.Print("content.PostGuestComment: ", err)
+				return
+			}
+			// notifications wait until the comment is approved
+			if _, err := content.SaveMentions(pool, id, content.ParseMentions(comment)); err != nil {
+				log.Print("content.SaveMentions: ", err)
+			}
+			log.Printf("guest comment from %q awaiting moderation", name)
+			if err := notify.EmitAdmins(pool, "moderation", fmt.Sprintf("%s left a comment on %q awaiting approval", name, data.Title), "/admin"); err != nil {
+				log.Print("notify.EmitAdmins: ", err)
+			}
+			assert(ts["post"].ExecuteTemplate(w, "guest-pending", data))
+			return
+		}
 
 		// TODO: update with actual users from users package
 		userExists, err := users.Exists(pool, data.Profile)
@@ -92,16 +229,533 @@ func main() {
 			return
 		}
 		if userExists {
-			comments, err := content.PostComment(pool, data.ID, data.Profile, comment)
+			muted, err := users.Sanctioned(pool, data.Profile, users.Mute)
+			if err != nil {
+				log.Print("users.Sanctioned: ", err)
+				return
+			}
+			banned, err := users.Sanctioned(pool, data.Profile, users.Ban)
+			if err != nil {
+				log.Print("users.Sanctioned: ", err)
+				return
+			}
+			if muted || banned {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				assert(ts["post"].ExecuteTemplate(w, "comment-error", "You can't comment right now."))
+				return
+			}
+			// a shadowbanned user's comment looks normal to them, and goes nowhere else
+			shadow, err := users.Sanctioned(pool, data.Profile, users.Shadowban)
+			if err != nil {
+				log.Print("users.Sanctioned: ", err)
+				return
+			}
+			comments, err := content.PostComment(pool, data.ID, data.Profile, comment, shadow)
 			if err != nil {
 				log.Print(err)
 				return
 			}
+			comments[0].Mentions, err = content.SaveMentions(pool, comments[0].ID, content.ParseMentions(comment))
+			if err != nil {
+				log.Print("content.SaveMentions: ", err)
+			}
 			assert(ts["post"].ExecuteTemplate(w, "oob-comment", comments[0])) // update the comments
 			assert(ts["post"].ExecuteTemplate(w, "form", data))               // replace form with an empty one
+			if shadow {
+				return
+			}
+
+			// everyone else reading this post gets the new comment over SSE
+			var buf bytes.Buffer
+			assert(ts["post"].ExecuteTemplate(&buf, "comment", comments[0]))
+			token := ""
+			if c, err := r.Cookie("session_token"); err == nil {
+				token = c.Value
+			}
+			hub.Publish(data.Link, buf.Bytes(), token)
+			go notifier.Mentioned(comments[0].ID)
+			go notifier.CommentCreated(data.ID, comments[0].ID, data.Profile, comment)
+		}
+	})
+
+	http.HandleFunc("GET /posts/{link}/comments.xml", func(w http.ResponseWriter, r *http.Request) {
+		post, err := content.GetPostContent(pool, r.PathValue("link"))
+		if err != nil || !post.Visible("") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		items, err := content.GetCommentFeed(pool, post.ID, 50)
+		if err != nil {
+			log.Print("content.GetCommentFeed: ", err)
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		assert(ts["rss"].ExecuteTemplate(w, "comments-rss", commentFeed{
+			SiteURL: strings.TrimSuffix(cfg.SiteURL, "/"),
+			Title:   "Comments on " + post.Title,
+			Summary: post.Summary,
+			Link:    "/posts/" + post.Link,
+			Self:    "/posts/" + post.Link + "/comments.xml",
+			Items:   items,
+		}))
+	})
+
+	http.HandleFunc("GET /comments.xml", func(w http.ResponseWriter, r *http.Request) {
+		items, err := content.GetCommentFeed(pool, 0, 50)
+		if err != nil {
+			log.Print("content.GetCommentFeed: ", err)
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		assert(ts["rss"].ExecuteTemplate(w, "comments-rss", commentFeed{
+			SiteURL: strings.TrimSuffix(cfg.SiteURL, "/"),
+			Title:   "Recent comments",
+			Summary: "The latest comments on all posts",
+			Link:    "/posts",
+			Self:    "/comments.xml",
+			Items:   items,
+		}))
+	})
+
+	http.HandleFunc("GET /posts/{link}/events", func(w http.ResponseWriter, r *http.Request) {
+		link := r.PathValue("link")
+		viewer := ""
+		if sess, ok := getSession(r); ok {
+			viewer = sess.username
+		}
+		if post, err := content.GetPostContent(pool, link); err != nil || !post.Visible(viewer) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+		token := ""
+		if c, err := r.Cookie("session_token"); err == nil {
+			token = c.Value
+		}
+		sub := hub.Subscribe(link, token)
+		defer hub.Unsubscribe(sub)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		flusher.Flush()
+
+		keepalive := time.NewTicker(30 * time.Second) // stop proxies from closing an idle stream
+		defer keepalive.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case msg := <-sub.C:
+				if err := live.WriteEvent(w, "comment", msg); err != nil {
+					return
+				}
+				flusher.Flush()
+			case <-keepalive.C:
+				if _, err := w.Write([]byte(": keepalive\n\n")); err != nil {
+					return
+				}
+				flusher.Flush()
+			}
 		}
 	})
 
+	http.HandleFunc("POST /reactions/{target}/{id}/{kind}", func(w http.ResponseWriter, r *http.Request) {
+		sess, ok := getSession(r)
+		if !ok {
+			// pop up the login form instead of swapping the buttons
+			w.Header().Set("HX-Retarget", "#login-target")
+			w.Header().Set("HX-Reswap", "innerHTML")
+			assert(ts["profile"].ExecuteTemplate(w, "profile", nil))
+			return
+		}
+		target, kind := r.PathValue("target"), r.PathValue("kind")
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil || !content.ValidReaction(kind) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		err = content.ToggleReaction(pool, target, id, sess.username, kind)
+		if errors.Is(err, content.ErrNoTarget) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Print("content.ToggleReaction: ", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		reactions, err := content.GetReactions(pool, target, id, sess.username)
+		if err != nil {
+			log.Print("content.GetReactions: ", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		assert(ts["post"].ExecuteTemplate(w, "reactions", reactions))
+	})
+
+	// https://www.w3.org/TR/webmention/#receiving-webmentions
+	http.HandleFunc("POST /webmention", func(w http.ResponseWriter, r *http.Request) {
+		source, target := r.PostFormValue("source"), r.PostFormValue("target")
+		if !webmention.ValidURL(source) || !webmention.ValidURL(target) || source == target {
+			http.Error(w, "source and target must be two different http(s) URLs", http.StatusBadRequest)
+			return
+		}
+		site, _ := url.Parse(cfg.SiteURL)
+		t, _ := url.Parse(target)
+		link, isPost := strings.CutPrefix(strings.TrimSuffix(t.Path, "/"), "/posts/")
+		if t.Host != site.Host || !isPost {
+			http.Error(w, "target is not a post on this site", http.StatusBadRequest)
+			return
+		}
+		post, err := content.GetPostContent(pool, link)
+		if err != nil || !post.Visible("") {
+			http.Error(w, "target is not a post on this site", http.StatusBadRequest)
+			return
+		}
+		if err := content.AddWebmention(pool, post.ID, source); err != nil {
+			log.Print("content.AddWebmention: ", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+
+		// verification happens later so the sender isn't kept waiting
+		go func() {
+			m, err := mentions.Verify(source, target)
+			switch {
+			case err == nil:
+				err = content.VerifyWebmention(pool, post.ID, source, m.URL, m.AuthorName, m.AuthorURL, m.Content, m.Published)
+				if err != nil {
+					log.Print("content.VerifyWebmention: ", err)
+				}
+				log.Printf("webmention from %q verified", source)
+			case errors.Is(err, webmention.ErrNoLink), errors.Is(err, webmention.ErrGone):
+				log.Printf("webmention from %q rejected: %v", source, err)
+				if err := content.DeleteWebmention(pool, post.ID, source); err != nil {
+					log.Print("content.DeleteWebmention: ", err)
+				}
+			default:
+				log.Printf("webmention from %q not verified: %v", source, err)
+			}
+		}()
+	})
+
+	http.HandleFunc("GET /users/{username}", func(w http.ResponseWriter, r *http.Request) {
+		site := Site{}
+		if sess, ok := getSession(r); ok {
+			site.Profile = sess.username
+		}
+		u, err := users.Get(pool, r.PathValue("username"))
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			site.Title = "not found"
+			assert(ts["404"].ExecuteTemplate(w, "404", site))
+			return
+		}
+		comments, err := content.GetUserComments(pool, u.Username, site.Profile, 20)
+		if err != nil {
+			log.Print("content.GetUserComments: ", err)
+		}
+		site.Title = u.Username
+		site.Summary = "joined " + u.Created.Format("2006-01-02")
+		site.Content = comments
+		site.Meta = meta.Page("/users/"+u.Username, site.Title, site.Title+" "+site.Summary)
+		assert(ts["user"].ExecuteTemplate(w, "user", site))
+	})
+
+	http.HandleFunc("GET /notifications/count", func(w http.ResponseWriter, r *http.Request) {
+		sess, ok := getSession(r)
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		count, err := notify.UnreadCount(pool, sess.username)
+		if err != nil {
+			log.Print("notify.UnreadCount: ", err)
+			return
+		}
+		if count > 0 {
+			fmt.Fprintf(w, `<span class="count">%d</span>`, count)
+		}
+	})
+
+	http.HandleFunc("GET /notifications", func(w http.ResponseWriter, r *http.Request) {
+		sess, ok := getSession(r)
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		unread, err := notify.Unread(pool, sess.username, 20)
+		if err != nil {
+			log.Print("notify.Unread: ", err)
+		}
+		assert(ts["base"].ExecuteTemplate(w, "inbox-list", unread))
+	})
+
+	// following a notification marks it read on the way
+	http.HandleFunc("GET /notifications/{id}", func(w http.ResponseWriter, r *http.Request) {
+		sess, ok := getSession(r)
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if !ok || err != nil {
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+		link, err := notify.MarkRead(pool, sess.username, id)
+		if err != nil || !strings.HasPrefix(link, "/") {
+			link = "/"
+		}
+		http.Redirect(w, r, link, http.StatusSeeOther)
+	})
+
+	http.HandleFunc("POST /notifications/{id}/read", func(w http.ResponseWriter, r *http.Request) {
+		sess, ok := getSession(r)
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if !ok || err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if _, err := notify.MarkRead(pool, sess.username, id); err != nil {
+			log.Print("notify.MarkRead: ", err)
+		}
+		// empty response removes it from the list
+		w.Header().Set("HX-Trigger", "inboxChanged")
+	})
+
+	http.HandleFunc("POST /notifications/read", func(w http.ResponseWriter, r *http.Request) {
+		sess, ok := getSession(r)
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if err := notify.MarkAllRead(pool, sess.username); err != nil {
+			log.Print("notify.MarkAllRead: ", err)
+		}
+		w.Header().Set("HX-Trigger", "inboxChanged")
+		assert(ts["base"].ExecuteTemplate(w, "inbox-list", []notify.Notification{}))
+	})
+
+	http.HandleFunc("GET /settings", func(w http.ResponseWriter, r *http.Request) {
+		site := Site{Title: "Settings", Summary: "Log in to change your settings."}
+		if sess, ok := getSession(r); ok {
+			site.Profile = sess.username
+			prefs, err := notify.GetPrefs(pool, sess.username)
+			if err != nil {
+				log.Print("notify.GetPrefs: ", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			site.Summary = "Notification settings"
+			site.Content = prefs
+		}
+		assert(ts["settings"].ExecuteTemplate(w, "settings", site))
+	})
+
+	http.HandleFunc("POST /settings", func(w http.ResponseWriter, r *http.Request) {
+		sess, ok := getSession(r)
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		prefs := notify.Prefs{
+			PostComment: r.PostFormValue("on_post_comment") == "on",
+			ThreadReply: r.PostFormValue("on_thread_reply") == "on",
+			Mention:     r.PostFormValue("on_mention") == "on",
+		}
+		if err := notify.SetPrefs(pool, sess.username, prefs); err != nil {
+			log.Print("notify.SetPrefs: ", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		assert(ts["settings"].ExecuteTemplate(w, "settings-form", prefs))
+	})
+
+	http.HandleFunc("GET /unsubscribe/{token}", func(w http.ResponseWriter, r *http.Request) {
+		site := Site{Title: "Unsubscribed", Summary: "You won't get any more comment emails."}
+		ok, err := notify.Unsubscribe(pool, r.PathValue("token"))
+		if err != nil || !ok {
+			log.Print("notify.Unsubscribe: ", err)
+			w.WriteHeader(http.StatusNotFound)
+			site.Title = "Unsubscribe"
+			site.Summary = "That unsubscribe link isn't valid (anymore?)."
+		}
+		assert(ts["settings"].ExecuteTemplate(w, "settings", site))
+	})
+
+	http.HandleFunc("GET /admin", func(w http.ResponseWriter, r *http.Request) {
+		site := Site{Title: "Admin", Summary: "Moderation"}
+		if !isAdmin(pool, r, &site) {
+			w.WriteHeader(http.StatusNotFound)
+			assert(ts["404"].ExecuteTemplate(w, "404", site))
+			return
+		}
+		pending, err := content.GetPendingComments(pool)
+		if err != nil {
+			log.Print("content.GetPendingComments: ", err)
+		}
+		reports, err := content.GetReports(pool)
+		if err != nil {
+			log.Print("content.GetReports: ", err)
+		}
+		sanctions, err := users.ActiveSanctions(pool)
+		if err != nil {
+			log.Print("users.ActiveSanctions: ", err)
+		}
+		site.Content = adminQueue{pending, reports, sanctions}
+		assert(ts["admin"].ExecuteTemplate(w, "admin", site))
+	})
+
+	http.HandleFunc("POST /admin/comments/{id}/{action}", func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(pool, r, &Site{}) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		id, err := strconv.Atoi(r.PathValue("id"))
+		action := r.PathValue("action")
+		if err != nil || (action != "approve" && action != "reject") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		c, err := content.ModerateComment(pool, id, action == "approve")
+		if err != nil {
+			log.Print("content.ModerateComment: ", err)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		log.Printf("comment %d %sd", id, action)
+		if action == "approve" {
+			comments, err := content.GetComments(pool, c.PostID, "")
+			if err != nil {
+				log.Print("content.GetComments: ", err)
+			}
+			for _, approved := range comments {
+				if approved.ID == c.ID {
+					approved.Reactions = content.NewReactions("comment", c.ID)
+					var buf bytes.Buffer
+					assert(ts["post"].ExecuteTemplate(&buf, "comment", approved))
+					hub.Publish(c.PostLink, buf.Bytes(), "")
+				}
+			}
+			go notifier.Mentioned(c.ID)
+			go notifier.CommentCreated(c.PostID, c.ID, c.Username, c.Content)
+		}
+		// empty response removes the comment from the queue
+	})
+
+	http.HandleFunc("POST /comments/{id}/report", func(w http.ResponseWriter, r *http.Request) {
+		sess, ok := getSession(r)
+		if !ok {
+			w.Header().Set("HX-Retarget", "#login-target")
+			w.Header().Set("HX-Reswap", "innerHTML")
+			assert(ts["profile"].ExecuteTemplate(w, "profile", nil))
+			return
+		}
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		reason := strings.TrimSpace(r.Header.Get("HX-Prompt")) // from hx-prompt
+		if len(reason) > 500 {
+			reason = reason[:500]
+		}
+		err = content.ReportComment(pool, id, sess.username, reason)
+		if errors.Is(err, content.ErrNoTarget) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Print("content.ReportComment: ", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		log.Printf("comment %d reported by %q", id, sess.username)
+		if err := notify.EmitAdmins(pool, "moderation", fmt.Sprintf("%s reported a comment", sess.username), "/admin"); err != nil {
+			log.Print("notify.EmitAdmins: ", err)
+		}
+		w.Write([]byte(`<span class="reported">reported, thanks</span>`))
+	})
+
+	http.HandleFunc("POST /admin/reports/{id}/{action}", func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(pool, r, &Site{}) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		id, err := strconv.Atoi(r.PathValue("id"))
+		action := r.PathValue("action")
+		if err != nil || (action != "dismiss" && action != "remove") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		reporters, err := content.ResolveReports(pool, id, action == "remove")
+		if err != nil {
+			log.Print("content.ResolveReports: ", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		outcome := "the comment you reported was removed"
+		if action == "dismiss" {
+			outcome = "the comment you reported was reviewed and left up"
+		}
+		for _, reporter := range reporters {
+			if err := notify.Emit(pool, reporter, "moderation", "Thanks for your report: "+outcome, ""); err != nil {
+				log.Print("notify.Emit: ", err)
+			}
+		}
+		// empty response removes the report from the queue
+	})
+
+	http.HandleFunc("POST /admin/users/{username}/sanction", func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(pool, r, &Site{}) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		username, kind := r.PathValue("username"), r.PostFormValue("kind")
+		hours, err := strconv.Atoi(r.PostFormValue("hours")) // 0 means permanent
+		if err != nil || hours < 0 || !users.ValidSanction(kind) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		d := time.Duration(hours) * time.Hour
+		if err := users.AddSanction(pool, username, kind, r.PostFormValue("reason"), d); err != nil {
+			log.Print("users.AddSanction: ", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		log.Printf("%s applied to %q for %v", kind, username, d)
+		until := "until further notice"
+		if d > 0 {
+			until = "until " + time.Now().Add(d).Format("2006-01-02 15:04 MST")
+		}
+		switch kind {
+		case users.Ban:
+			endSessions(username)
+		case users.Mute:
+			// shadowbans are deliberately not announced
+			if err := notify.Emit(pool, username, "moderation", "You've been muted "+until+" and can't comment", ""); err != nil {
+				log.Print("notify.Emit: ", err)
+			}
+		}
+		fmt.Fprintf(w, `<span class="sanctioned">%s %s</span>`, kind, until)
+	})
+
+	http.HandleFunc("POST /admin/users/{username}/lift", func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(pool, r, &Site{}) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		username := r.PathValue("username")
+		if err := users.LiftSanctions(pool, username); err != nil {
+			log.Print("users.LiftSanctions: ", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		log.Printf("sanctions lifted for %q", username)
+		// empty response removes the row
+	})
+
 	http.HandleFunc("GET /profile", func(w http.ResponseWriter, r *http.Request) {
 		if _, ok := getSession(r); ok {
 			return
@@ -123,7 +777,9 @@ func main() {
 			w.WriteHeader(http.StatusBadRequest)
 			goto cleanup
 		}
+		sessionsMu.Lock()
 		delete(sessions, c.Value)
+		sessionsMu.Unlock()
 	cleanup:
 		// TODO: could this be better handled somewhere else?
 		parsedURL, err := url.Parse(r.Referer())
@@ -136,11 +792,13 @@ func main() {
 				ts["post"].ExecuteTemplate(w, "form", struct {
 					Profile string
 					Link    string
-				}{"", pathParts[2]})
+					Guests  bool
+				}{"", pathParts[2], cfg.GuestComments})
 			}
 		}
 		log.Print("logged out user")
 		http.SetCookie(w, &http.Cookie{Name: "session_token", Value: "", Expires: time.Now()})
+		assert(ts["base"].ExecuteTemplate(w, "inbox", ""))
 		w.Write([]byte(`<a id="login-logout" href="#" hx-get="/profile" hx-target="#login-target">Login</a>`))
 	})
 
@@ -156,12 +814,28 @@ func main() {
 			log.Printf("users.CheckPW fail:%q", err)
 		}
 		if match {
+			banned, err := users.Sanctioned(pool, username, users.Ban)
+			if err != nil {
+				log.Print("users.Sanctioned: ", err)
+			}
+			if banned || err != nil {
+				log.Printf("banned user login attempt:%q", username)
+				w.WriteHeader(http.StatusUnauthorized)
+				data := struct {
+					Username string
+					Error    string
+				}{username, "This account has been suspended"}
+				assert(ts["profile"].ExecuteTemplate(w, "profile", data))
+				return
+			}
 			sessionToken := uuid.NewString()
 			expiresAt := time.Now().Add(3600 * time.Second) // auto logout after 60*60 seconds
+			sessionsMu.Lock()
 			sessions[sessionToken] = session{
 				username: username,
 				expires:  expiresAt,
 			}
+			sessionsMu.Unlock()
 			http.SetCookie(w, &http.Cookie{
 				Name:    "session_token",
 				Value:   sessionToken,
@@ -169,6 +843,7 @@ func main() {
 			})
 			w.Write([]byte(`<div id="login-container" class="invisible"></div>`))
 			w.Write([]byte(`<a id="login-logout" hx-swap-oob="true" hx-swap="outerHTML" href="#" hx-get="/logout">Logout ` + username + `</a>`))
+			assert(ts["base"].ExecuteTemplate(w, "inbox", username))
 
 			// TODO: could this be better handled somewhere else?
 			// if we're on a post page, there's an add-comment box that should appear after login succeeds
@@ -182,7 +857,8 @@ func main() {
 				ts["post"].ExecuteTemplate(w, "form", struct {
 					Profile string
 					Link    string
-				}{username, pathParts[2]})
+					Guests  bool
+				}{username, pathParts[2], cfg.GuestComments})
 			}
 		} else {
 			log.Printf("bad login attempt:%q", username)
@@ -207,22 +883,59 @@ func main() {
 		if sess, ok := getSession(r); ok {
 			data.Profile = sess.username
 		}
-		file, err := os.Open("./public/posts/" + link + ".html")
+		if !data.Visible(data.Profile) {
+			w.WriteHeader(http.StatusNotFound)
+			assert(ts["404"].ExecuteTemplate(w, "404", Site{Title: "not found", Profile: data.Profile}))
+			return
+		}
+		data.Guests = cfg.GuestComments
+		body, err := bodies.Body(link)
 		if err != nil {
 			log.Printf("GET /posts/{link} err:%v", err)
 			return
 		}
-		defer file.Close()
-		fileContent, err := ioutil.ReadAll(file)
+		data.Editable = editable(body) && isAdmin(pool, r, &Site{})
+		page, err := rewriter.Render(body.HTML())
 		if err != nil {
-			log.Printf("ioutil.Readall(file) error: %v", err)
-			return
+			log.Printf("GET /posts/{link} rewrite: %v", err)
 		}
-		data.Content = template.HTML(string(fileContent)) // what type?
-		data.Comments, err = content.GetComments(pool, data.ID)
+		data.Content, data.TOC, data.Words, data.Minutes = page.HTML, page.TOC, page.Words, page.Minutes
+		data.Comments, err = content.GetComments(pool, data.ID, data.Profile)
 		if err != nil {
 			log.Print("content.GetComments: ", err)
 		}
+		data.Tags, err = content.GetPostTags(pool, data.ID)
+		if err != nil {
+			log.Print("content.GetPostTags: ", err)
+		}
+		data.Series, err = content.GetPostSeries(pool, data.Link)
+		if err != nil {
+			log.Print("content.GetPostSeries: ", err)
+		}
+		data.Related, err = content.GetRelated(pool, data.ID)
+		if err != nil {
+			log.Print("content.GetRelated: ", err)
+		}
+		data.Webmentions, err = content.GetWebmentions(pool, data.ID)
+		if err != nil {
+			log.Print("content.GetWebmentions: ", err)
+		}
+		data.Reactions, err = content.GetReactions(pool, "post", data.ID, data.Profile)
+		if err != nil {
+			log.Print("content.GetReactions: ", err)
+		}
+		data.Meta = meta.Post(data)
+		reactions, err := content.GetCommentReactions(pool, data.ID, data.Profile)
+		if err != nil {
+			log.Print("content.GetCommentReactions: ", err)
+		}
+		for i, c := range data.Comments {
+			if r, ok := reactions[c.ID]; ok {
+				data.Comments[i].Reactions = r
+			} else {
+				data.Comments[i].Reactions = content.NewReactions("comment", c.ID)
+			}
+		}
 		if val, ok := ts["post"]; ok {
 			err := val.ExecuteTemplate(w, "post", data)
 			if err != nil {
@@ -233,6 +946,320 @@ func main() {
 		}
 	})
 
+	http.HandleFunc("GET /search", func(w http.ResponseWriter, r *http.Request) {
+		q := strings.TrimSpace(r.URL.Query().Get("q"))
+		results := struct {
+			Query   string
+			Results []content.SearchResult
+		}{Query: q}
+		if q != "" {
+			var err error
+			results.Results, err = content.Search(pool, q, 20)
+			if err != nil {
+				log.Print("content.Search: ", err)
+			}
+		}
+		// the nav box only wants the list
+		if r.Header.Get("HX-Request") == "true" {
+			assert(ts["search"].ExecuteTemplate(w, "search-results", results))
+			return
+		}
+		site := Site{Title: "Search", Summary: "Search posts and papers", Content: results}
+		if sess, ok := getSession(r); ok {
+			site.Profile = sess.username
+		}
+		assert(ts["search"].ExecuteTemplate(w, "search", site))
+	})
+
+	http.HandleFunc("GET /tags", func(w http.ResponseWriter, r *http.Request) {
+		site := Site{Title: "Tags", Summary: "Posts by topic"}
+		if sess, ok := getSession(r); ok {
+			site.Profile = sess.username
+		}
+		tags, err := content.GetTags(pool)
+		if err != nil {
+			log.Print("content.GetTags: ", err)
+		}
+		site.Content = tags
+		site.Meta = meta.Page("/tags", site.Title, site.Summary)
+		assert(ts["tags"].ExecuteTemplate(w, "tags", site))
+	})
+
+	http.HandleFunc("GET /tags/{tag}", func(w http.ResponseWriter, r *http.Request) {
+		tag := content.TagSlug(r.PathValue("tag"))
+		site := Site{Title: "#" + tag, Summary: "Posts tagged " + tag, Content: tag}
+		if sess, ok := getSession(r); ok {
+			site.Profile = sess.username
+		}
+		thumbs, err := content.GetTaggedThumbnails(pool, tag)
+		if err != nil {
+			log.Print("content.GetTaggedThumbnails: ", err)
+		}
+		if len(thumbs) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			site.Title = "not found"
+			assert(ts["404"].ExecuteTemplate(w, "404", site))
+			return
+		}
+		site.Thumbs = thumbs
+		site.Meta = meta.Page("/tags/"+tag, site.Title, site.Summary)
+		assert(ts["tag"].ExecuteTemplate(w, "tag", site))
+	})
+
+	http.HandleFunc("GET /tags/{tag}/rss.xml", func(w http.ResponseWriter, r *http.Request) {
+		tag := content.TagSlug(r.PathValue("tag"))
+		items, err := content.GetPostFeed(pool, tag)
+		if err != nil || len(items) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		assert(ts["rss"].ExecuteTemplate(w, "rss", postFeed{
+			SiteURL: strings.TrimSuffix(cfg.SiteURL, "/"),
+			Title:   "Alex Shroyer: " + tag,
+			Summary: "Posts tagged " + tag,
+			Link:    "/tags/" + tag,
+			Self:    "/tags/" + tag + "/rss.xml",
+			Items:   items,
+		}))
+	})
+
+	http.HandleFunc("GET /series/{slug}", func(w http.ResponseWriter, r *http.Request) {
+		series, err := content.GetSeries(pool, content.TagSlug(r.PathValue("slug")))
+		if err != nil {
+			log.Print("content.GetSeries: ", err)
+		}
+		site := Site{Title: "not found"}
+		if sess, ok := getSession(r); ok {
+			site.Profile = sess.username
+		}
+		if series == nil || len(series.Parts) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			assert(ts["404"].ExecuteTemplate(w, "404", site))
+			return
+		}
+		site.Title, site.Summary, site.Content = series.Title, series.Summary, series
+		if site.Summary == "" {
+			site.Summary = fmt.Sprintf("A series in %d parts", len(series.Parts))
+		}
+		site.Meta = meta.Page("/series/"+series.Slug, site.Title, site.Summary)
+		assert(ts["series"].ExecuteTemplate(w, "series", site))
+	})
+
+	http.HandleFunc("GET /series/{slug}/rss.xml", func(w http.ResponseWriter, r *http.Request) {
+		series, err := content.GetSeries(pool, content.TagSlug(r.PathValue("slug")))
+		if err != nil || series == nil || len(series.Parts) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		items, err := content.GetSeriesFeed(pool, series.Slug)
+		if err != nil {
+			log.Print("content.GetSeriesFeed: ", err)
+		}
+		feed := postFeed{
+			SiteURL: strings.TrimSuffix(cfg.SiteURL, "/"),
+			Title:   "Alex Shroyer: " + series.Title,
+			Summary: series.Summary,
+			Link:    "/series/" + series.Slug,
+			Self:    "/series/" + series.Slug + "/rss.xml",
+			Items:   items,
+		}
+		if feed.Summary == "" {
+			feed.Summary = "Every part of " + series.Title
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		assert(ts["rss"].ExecuteTemplate(w, "rss", feed))
+	})
+
+	// the editor is for admins, and saves straight to the database
+	http.HandleFunc("GET /editor", func(w http.ResponseWriter, r *http.Request) {
+		site := Site{Title: "New post", Summary: "Write a new post"}
+		if !isAdmin(pool, r, &site) {
+			w.WriteHeader(http.StatusNotFound)
+			assert(ts["404"].ExecuteTemplate(w, "404", Site{Title: "not found", Profile: site.Profile}))
+			return
+		}
+		site.Content = content.Draft{Status: "draft"}
+		assert(ts["editor"].ExecuteTemplate(w, "editor", site))
+	})
+
+	http.HandleFunc("GET /posts/{link}/edit", func(w http.ResponseWriter, r *http.Request) {
+		link := r.PathValue("link")
+		site := Site{Title: "Edit post"}
+		if !isAdmin(pool, r, &site) {
+			w.WriteHeader(http.StatusNotFound)
+			assert(ts["404"].ExecuteTemplate(w, "404", Site{Title: "not found", Profile: site.Profile}))
+			return
+		}
+		draft, err := content.GetDraft(pool, link)
+		if err != nil {
+			log.Print("content.GetDraft: ", err)
+			w.WriteHeader(http.StatusNotFound)
+			assert(ts["404"].ExecuteTemplate(w, "404", Site{Title: "not found", Profile: site.Profile}))
+			return
+		}
+		// posts that were never imported still have their body on disk
+		body, err := bodies.Body(link)
+		if err != nil && !errors.Is(err, content.ErrNoBody) {
+			log.Print("bodies.Body: ", err)
+		}
+		if !editable(body) {
+			// saving would quietly turn the source into rendered HTML
+			http.Error(w, "This post is written in "+body.Format+", edit its file instead.", http.StatusConflict)
+			return
+		}
+		draft.Body = string(body.Text)
+		site.Summary = "Editing " + draft.Title
+		site.Content = draft
+		assert(ts["editor"].ExecuteTemplate(w, "editor", site))
+	})
+
+	http.HandleFunc("POST /editor/preview", func(w http.ResponseWriter, r *http.Request) {
+		if !isAdmin(pool, r, &Site{}) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		preview := content.Post{
+			Title:   r.PostFormValue("title"),
+			Summary: r.PostFormValue("summary"),
+			Status:  r.PostFormValue("status"),
+			Date:    time.Now().Format("January 2, 2006"),
+		}
+		page, _ := rewriter.Rewrite(template.HTML(r.PostFormValue("body")))
+		preview.Content, preview.TOC, preview.Words, preview.Minutes = page.HTML, page.TOC, page.Words, page.Minutes
+		assert(ts["post"].ExecuteTemplate(w, "article", preview))
+	})
+
+	http.HandleFunc("POST /editor", func(w http.ResponseWriter, r *http.Request) {
+		site := Site{}
+		if !isAdmin(pool, r, &site) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		draft := content.Draft{
+			Link:    strings.TrimSpace(r.PostFormValue("link")),
+			Title:   strings.TrimSpace(r.PostFormValue("title")),
+			Summary: strings.TrimSpace(r.PostFormValue("summary")),
+			Series:  strings.TrimSpace(r.PostFormValue("series")),
+			Image:   strings.TrimSpace(r.PostFormValue("image")),
+			Status:  r.PostFormValue("status"),
+			Body:    r.PostFormValue("body"),
+		}
+		draft.ID, _ = strconv.Atoi(r.PostFormValue("id"))
+		if draft.ID != 0 {
+			link, err := content.GetPostLink(pool, draft.ID)
+			if err != nil {
+				log.Print("content.GetPostLink: ", err)
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if body, err := bodies.Body(link); err == nil && !editable(body) {
+				w.WriteHeader(http.StatusConflict)
+				assert(ts["editor"].ExecuteTemplate(w, "editor-error", "This post is written in "+body.Format+", edit its file instead."))
+				return
+			}
+		}
+		if v := r.PostFormValue("publish_at"); v != "" {
+			t, err := time.Parse("2006-01-02T15:04", v)
+			if err != nil {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				assert(ts["editor"].ExecuteTemplate(w, "editor-error", "The publish time doesn't look right."))
+				return
+			}
+			draft.PublishAt = &t
+		}
+		problem := draft.Problem()
+		if problem == "" {
+			taken, err := content.PostTaken(pool, draft)
+			if err != nil {
+				log.Print("content.PostTaken: ", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			if taken {
+				problem = "Another post already has that link or title."
+			}
+		}
+		if problem != "" {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			assert(ts["editor"].ExecuteTemplate(w, "editor-error", problem))
+			return
+		}
+		if err := content.SavePost(pool, &draft, site.Profile); err != nil {
+			log.Print("content.SavePost: ", err)
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			assert(ts["editor"].ExecuteTemplate(w, "editor-error", "Couldn't save the post."))
+			return
+		}
+		log.Printf("%s saved post %q (%s)", site.Profile, draft.Link, draft.Status)
+		w.Header().Set("HX-Replace-Url", "/posts/"+draft.Link+"/edit")
+		assert(ts["editor"].ExecuteTemplate(w, "editor-saved", draft))
+	})
+
+	http.HandleFunc("GET /posts/{link}/history", func(w http.ResponseWriter, r *http.Request) {
+		link := r.PathValue("link")
+		site := Site{}
+		admin := isAdmin(pool, r, &site)
+		post, err := content.GetPostContent(pool, link)
+		if err != nil || !post.Visible(site.Profile) {
+			w.WriteHeader(http.StatusNotFound)
+			assert(ts["404"].ExecuteTemplate(w, "404", Site{Title: "not found", Profile: site.Profile}))
+			return
+		}
+		revisions, err := content.GetRevisions(pool, link)
+		if err != nil {
+			log.Print("content.GetRevisions: ", err)
+		}
+		history := struct {
+			Post      content.Post
+			Revisions []content.Revision
+			From, To  content.Revision
+			Latest    int
+			Diff      []diff.Line
+			Admin     bool
+		}{Post: post, Revisions: revisions, Admin: admin}
+		// ?to= picks a revision, which is compared with the one before it
+		to, _ := strconv.Atoi(r.URL.Query().Get("to"))
+		for i, rev := range revisions {
+			if to == 0 || rev.ID == to {
+				history.To = rev
+				if i+1 < len(revisions) {
+					history.From = revisions[i+1]
+				}
+				break
+			}
+		}
+		if len(revisions) > 0 {
+			history.Latest = revisions[0].ID
+			history.Diff = diff.Lines(history.From.Content, history.To.Content)
+		}
+		site.Title = post.Title + " (history)"
+		site.Summary = "Revisions of " + post.Title
+		site.Content = history
+		assert(ts["history"].ExecuteTemplate(w, "history", site))
+	})
+
+	http.HandleFunc("POST /posts/{link}/revisions/{id}/restore", func(w http.ResponseWriter, r *http.Request) {
+		site := Site{}
+		if !isAdmin(pool, r, &site) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		link := r.PathValue("link")
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err := content.RestoreRevision(pool, link, id, site.Profile); err != nil {
+			log.Print("content.RestoreRevision: ", err)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		log.Printf("%s restored revision %d of %s", site.Profile, id, link)
+		http.Redirect(w, r, "/posts/"+link+"/history", http.StatusSeeOther)
+	})
+
 	http.HandleFunc("GET /cv", func(w http.ResponseWriter, r *http.Request) {
 		file, err := os.Open("./public/pages/cv.html")
 		if err != nil {
@@ -251,6 +1278,7 @@ func main() {
 			data.Profile = sess.username
 		}
 		data.Content = template.HTML(string(fileContent)) // what type?
+		data.Meta = meta.Page("/cv", "CV", "Curriculum vitae of Alex Shroyer")
 		if val, ok := ts["cv"]; ok {
 			err := val.ExecuteTemplate(w, "cv", data)
 			if err != nil {
@@ -269,33 +1297,12 @@ func main() {
 		if sess, ok := getSession(r); ok {
 			site.Profile = sess.username
 		}
-
-		site.Thumbs = []content.Thumbnail{
-			{
-				Link:    "intellisys2023.pdf",
-				Title:   "Detecting Standard Library Functions in Obfuscated Code",
-				Summary: "Binary analysis helps find low-level system bugs in embed- ded systems, middleware, and Internet of Things (IoT) devices. However, obfuscation makes static analysis more challenging. In this work we use machine learning to detect standard library functions in compiled code which has been heavily obfuscated. First we create a C library func- tion dataset augmented by obfuscation and diverse compiler options. We then train an ensemble of Paragraph Vector-Distributed Memory (PV- DM) models on this dataset, and combine their predictions with simple majority voting. Although the average accuracy of individual PV-DM classifiers is 68%, the ensemble is 74% accurate. Finally, we train a sepa- rate model on the graph structure of the disassembled data. This graph classifier is 64% accurate on its own, but does not improve accuracy when added to the ensemble. Unlike previous work, our approach works even with heavy obfuscation, an advantage we attribute to increased diversity of our training data and increased capacity of our ensemble model.",
-				Date:    "September 2023",
-			},
-			{
-				Link:    "aisc2022.pdf",
-				Title:   "Data Augmentation for Code Analysis",
-				Summary: "A key challenge of applying machine learning techniques to binary data is the lack of a large corpus of labeled training data. One solution to the lack of real-world data is to create synthetic data from real data through augmentation. In this paper, we demonstrate data augmentation techniques suitable for source code and compiled binary data. By augmenting existing data with semantically-similar sources, training set size is increased, and machine learning models better generalize to unseen data.",
-				Date:    "September 2022",
-			},
-			{
-				Link:    "inlocus.pdf",
-				Title:   "Data Distillation at the Network's Edge: Exposing Programmable Logic with InLocus",
-				Summary: "With proliferating sensor networks and Internet of Things-scale devices, networks are increasingly diverse and heterogeneous. To enable the most efficient use of network bandwidth with the lowest possible latency, we propose InLocus, a stream-oriented architecture situated at (or near) the network's edge which balances hardware-accelerated performance with the flexibility of asynchronous software-based control. In this paper we utilize a flexible platform (Xilinx Zynq SoC) to compare microbenchmarks of several InLocus implementations: naive JavaScript, Handwritten C, and High-Level Synthesis (HLS) in programmable hardware.",
-				Date:    "July 2018",
-			},
-			{
-				Link:    "offloading.pdf",
-				Title:   "Offloading Collective Operations to Programmable Logic",
-				Summary: "In this article, the authors present a framework for offloading collective operations to programmable logic for use in applications using the Message Passing Interface (MPI). They evaluate their approach on the Xilinx Zynq system on a chip and the NetFPGA, a network interface card based on a field-programmable gate array. Results are presented from microbenchmarks and a benchmark scientific application.",
-				Date:    "September 2017",
-			},
+		papers, err := content.GetPapers(pool)
+		if err != nil {
+			log.Printf("[papers] %v", err)
 		}
+		site.Thumbs = papers
+		site.Meta = meta.Papers("/papers", site.Title, site.Summary, papers)
 		assert(ts["papers"].ExecuteTemplate(w, "papers", site))
 	})
 
@@ -313,6 +1320,7 @@ func main() {
 		// 	assert(ts["404"].ExecuteTemplate(w, "404", nil))
 		// 	return
 		// }
+		site.Meta = meta.Page("/projects", site.Title, site.Summary)
 		assert(ts["projects"].ExecuteTemplate(w, "projects", site))
 	})
 
@@ -324,12 +1332,34 @@ func main() {
 		if sess, ok := getSession(r); ok {
 			site.Profile = sess.username
 		}
-		site.Thumbs, err = content.GetThumbnails(pool, -1)
+		site.After = r.URL.Query().Get("after")
+		site.Thumbs, site.Next, err = content.GetThumbnailPage(pool, site.After, postsPerPage)
+		if errors.Is(err, content.ErrBadCursor) {
+			http.Error(w, "bad page", http.StatusBadRequest)
+			return
+		}
 		if err != nil {
 			log.Printf("[thumbnails] %v", err)
 			assert(ts["404"].ExecuteTemplate(w, "404", nil))
 			return
 		}
+		if r.Header.Get("HX-Request") != "" && site.After != "" {
+			// infinite scroll: just the next cards, in place of the link that asked
+			assert(ts["posts"].ExecuteTemplate(w, "post-cards", site))
+			return
+		}
+		// drafts link to the editor, so they're only listed for those who can use it
+		if site.After == "" && isAdmin(pool, r, &site) {
+			site.Drafts, err = content.GetDrafts(pool, site.Profile)
+			if err != nil {
+				log.Print("content.GetDrafts: ", err)
+			}
+		}
+		path := "/posts"
+		if site.After != "" {
+			path += "?after=" + url.QueryEscape(site.After)
+		}
+		site.Meta = meta.Page(path, site.Title, site.Summary)
 		assert(ts["posts"].ExecuteTemplate(w, "posts", site))
 	})
 
@@ -348,14 +1378,24 @@ func main() {
 				log.Printf("[thumbnails] %v", err)
 				assert(ts["404"].ExecuteTemplate(w, "404", nil))
 			}
+			site.Meta = meta.Page("/", site.Title, site.Summary)
 			assert(ts["index"].ExecuteTemplate(w, "index", site))
 		case "/rss.xml":
-			if site.Thumbs, err = content.GetThumbnails(pool, -1); err != nil {
-				log.Printf("[thumbnails] %v", err)
-				assert(ts["404"].ExecuteTemplate(w, "404", nil))
+			items, err := content.GetPostFeed(pool, "")
+			if err != nil {
+				log.Print("content.GetPostFeed: ", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
 			}
 			w.Header().Set("Content-Type", "application/xml")
-			assert(ts["rss"].ExecuteTemplate(w, "rss", site))
+			assert(ts["rss"].ExecuteTemplate(w, "rss", postFeed{
+				SiteURL: strings.TrimSuffix(cfg.SiteURL, "/"),
+				Title:   site.Title,
+				Summary: site.Summary,
+				Link:    "/posts",
+				Self:    "/rss.xml",
+				Items:   items,
+			}))
 		default:
 			w.WriteHeader(http.StatusNotFound)
 			site.Title = "not found"
@@ -363,9 +1403,41 @@ func main() {
 		}
 	})
 
+	if cfg.Gemini.Addr != "" {
+		capsule := &gemini.Server{
+			Addr:     cfg.Gemini.Addr,
+			Hostname: cfg.Gemini.Hostname,
+			CertFile: cfg.Gemini.CertFile,
+			KeyFile:  cfg.Gemini.KeyFile,
+			Handler:  newCapsule(poolStore{pool}, bodies, cfg.SiteURL),
+		}
+		go func() {
+			log.Print("[gemini] ", capsule.ListenAndServe())
+		}()
+	}
+
 	log.Fatal(http.ListenAndServe("localhost:8080", nil))
 }
 
+// editable says whether the editor can open a body: it only works in HTML.
+func editable(body content.Body) bool {
+	return body.Format == "html"
+}
+
+// isAdmin checks the request's session and fills in site.Profile along the way.
+func isAdmin(pool *pgxpool.Pool, r *http.Request, site *Site) bool {
+	sess, ok := getSession(r)
+	if !ok {
+		return false
+	}
+	site.Profile = sess.username
+	admin, err := users.IsAdmin(pool, sess.username)
+	if err != nil {
+		log.Print("users.IsAdmin: ", err)
+	}
+	return admin
+}
+
 func assert(e ...any) {
 	if e[0] != nil {
 		log.Fatal(e...)
@@ -379,17 +1451,26 @@ func parseTemplates(prefix string) Templates {
 	t := Templates{} //make(map[string]*template.Template)
 	base := template.Must(template.ParseFiles(prefix + "base.html"))
 	t["base"] = base
-	t["rss"], err = template.Must(base.Clone()).ParseFiles(prefix + "rss.xml")
+	t["rss"], err = template.Must(base.Clone()).ParseFiles(prefix+"rss.xml", prefix+"comments.xml")
 	assert(err, "error parsing ", prefix+"rss.xml")
 	t["profile"] = template.Must(template.ParseFiles(prefix + "profile.html"))
 	html := []string{
 		"404",
+		"admin",
 		"cv",
+		"editor",
+		"history",
 		"index",
 		"papers",
 		"post",
 		"posts",
 		"projects",
+		"search",
+		"series",
+		"settings",
+		"tag",
+		"tags",
+		"user",
 	}
 	for _, h := range html {
 		name := prefix + h + ".html"
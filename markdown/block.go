@@ -0,0 +1,881 @@
+package markdown
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type blockKind int
+
+const (
+	document blockKind = iota
+	blockQuote
+	list
+	item
+	paragraph
+	heading
+	thematicBreak
+	codeBlock
+	htmlBlock
+	table
+	footnoteDef
+)
+
+type listData struct {
+	ordered      bool
+	bullet       byte // -, + or *
+	delim        byte // . or )
+	start        int
+	markerOffset int
+	padding      int
+}
+
+type block struct {
+	kind     blockKind
+	parent   *block
+	children []*block
+	open     bool
+
+	startLine, endLine int
+	lines              []string // raw text, for leaf blocks
+	content            string   // text once the block is closed
+	inlines            *node
+
+	level int // heading
+
+	fenced      bool // code
+	fenceChar   byte
+	fenceLen    int
+	fenceOffset int
+	info        string
+
+	listData
+	tight bool
+
+	htmlType int
+
+	aligns []string // table
+	header []string
+	rows   [][]string
+	cells  [][]*node // parsed header and rows
+
+	label string // footnote
+}
+
+func (b *block) lastChild() *block {
+	if len(b.children) == 0 {
+		return nil
+	}
+	return b.children[len(b.children)-1]
+}
+
+func (b *block) next() *block {
+	if b.parent == nil {
+		return nil
+	}
+	siblings := b.parent.children
+	for i, c := range siblings {
+		if c == b && i+1 < len(siblings) {
+			return siblings[i+1]
+		}
+	}
+	return nil
+}
+
+func (b *block) remove() {
+	siblings := b.parent.children
+	for i, c := range siblings {
+		if c == b {
+			b.parent.children = append(siblings[:i:i], siblings[i+1:]...)
+			return
+		}
+	}
+}
+
+func (b *block) replaceWith(other *block) {
+	other.parent = b.parent
+	for i, c := range b.parent.children {
+		if c == b {
+			b.parent.children[i] = other
+			return
+		}
+	}
+}
+
+func (b *block) canContain(k blockKind) bool {
+	switch b.kind {
+	case document, blockQuote, item, footnoteDef:
+		return k != item
+	case list:
+		return k == item
+	}
+	return false
+}
+
+// acceptsLines is true for leaf blocks whose text is built up line by line.
+func (b *block) acceptsLines() bool {
+	return b.kind == paragraph || b.kind == codeBlock || b.kind == htmlBlock || b.kind == table
+}
+
+// endsWithBlankLine says whether a blank line separates b from the block after
+// it, which is what makes a list loose.
+func (b *block) endsWithBlankLine() bool {
+	next := b.next()
+	return next != nil && b.endLine != next.startLine-1
+}
+
+type parser struct {
+	doc, tip            *block
+	oldTip, lastMatched *block
+	allClosed           bool
+
+	line         string
+	lineNumber   int
+	pos          int
+	nextNonspace int
+	indent       int
+	indented     bool
+	blank        bool
+
+	refs      map[string]ref
+	footnotes map[string]*block
+}
+
+type ref struct {
+	dest, title string
+}
+
+func newParser() *parser {
+	doc := &block{kind: document, open: true, startLine: 1}
+	return &parser{
+		doc:       doc,
+		tip:       doc,
+		oldTip:    doc,
+		allClosed: true,
+		refs:      map[string]ref{},
+		footnotes: map[string]*block{},
+	}
+}
+
+// expandTabs turns tabs in a line's indentation (including any block quote
+// markers) into spaces, so that columns and byte offsets agree there.
+func expandTabs(line string) string {
+	if !strings.Contains(line, "\t") {
+		return line
+	}
+	var b strings.Builder
+	col := 0
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch c {
+		case '\t':
+			n := 4 - col%4
+			b.WriteString(strings.Repeat(" ", n))
+			col += n
+		case ' ', '>':
+			b.WriteByte(c)
+			col++
+		default:
+			b.WriteString(line[i:])
+			return b.String()
+		}
+	}
+	return b.String()
+}
+
+// expandSpaces turns tabs in the spaces at the start of s into spaces, for s
+// starting at column col. Everything before a list item's content is one byte
+// per column by then, so this keeps the two in step after a list marker.
+func expandSpaces(s string, col int) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\t':
+			n := 4 - (col+b.Len())%4
+			b.WriteString(strings.Repeat(" ", n))
+		case ' ':
+			b.WriteByte(' ')
+		default:
+			return b.String() + s[i:]
+		}
+	}
+	return b.String()
+}
+
+func isBlank(s string) bool {
+	return strings.Trim(s, " \t\n") == ""
+}
+
+func peek(s string, i int) int {
+	if i < len(s) {
+		return int(s[i])
+	}
+	return -1
+}
+
+func isSpaceOrTab(c int) bool {
+	return c == ' ' || c == '\t'
+}
+
+func (p *parser) findNextNonspace() {
+	i := p.pos
+	for i < len(p.line) && (p.line[i] == ' ' || p.line[i] == '\t') {
+		i++
+	}
+	p.blank = i >= len(p.line)
+	p.nextNonspace = i
+	p.indent = i - p.pos
+	p.indented = p.indent >= 4
+}
+
+func (p *parser) advanceOffset(n int) {
+	p.pos = min(p.pos+n, len(p.line))
+}
+
+func (p *parser) advanceNextNonspace() {
+	p.pos = p.nextNonspace
+}
+
+func (p *parser) addChild(k blockKind) *block {
+	for !p.tip.canContain(k) {
+		p.finalize(p.tip, p.lineNumber-1)
+	}
+	b := &block{kind: k, parent: p.tip, open: true, startLine: p.lineNumber}
+	p.tip.children = append(p.tip.children, b)
+	p.tip = b
+	return b
+}
+
+func (p *parser) closeUnmatched() {
+	if !p.allClosed {
+		for p.oldTip != p.lastMatched {
+			parent := p.oldTip.parent
+			p.finalize(p.oldTip, p.lineNumber-1)
+			p.oldTip = parent
+		}
+		p.allClosed = true
+	}
+}
+
+func (p *parser) addLineToTip() {
+	p.tip.lines = append(p.tip.lines, p.line[p.pos:])
+}
+
+var reMaybeSpecial = regexp.MustCompile("^[#`~*+_=<>0-9|:\\[-]")
+
+// addLine feeds one line to the parser: first it works out which open blocks
+// the line continues, then whether it starts new ones, and finally adds what's
+// left of it to the innermost block.
+func (p *parser) addLine(raw string) {
+	p.line = expandTabs(raw)
+	p.pos = 0
+	p.lineNumber++
+	container := p.doc
+	p.oldTip = p.tip
+walk:
+	for {
+		last := container.lastChild()
+		if last == nil || !last.open {
+			break
+		}
+		container = last
+		p.findNextNonspace()
+		switch p.continues(container) {
+		case 1:
+			container = container.parent
+			break walk
+		case 2:
+			return // the line closed a fence
+		}
+	}
+	p.allClosed = container == p.oldTip
+	p.lastMatched = container
+
+	matchedLeaf := container.kind != paragraph && container.kind != table && container.acceptsLines()
+	for !matchedLeaf {
+		p.findNextNonspace()
+		if !p.indented && !reMaybeSpecial.MatchString(p.line[p.nextNonspace:]) {
+			p.advanceNextNonspace()
+			break
+		}
+		res := 0
+		for _, start := range blockStarts {
+			if res = start(p, container); res != 0 {
+				container = p.tip
+				matchedLeaf = res == 2
+				break
+			}
+		}
+		if res == 0 {
+			p.advanceNextNonspace()
+			break
+		}
+	}
+
+	if !p.allClosed && !p.blank && p.tip.kind == paragraph {
+		p.addLineToTip() // lazy continuation of a paragraph
+		return
+	}
+	p.closeUnmatched()
+	switch {
+	case container.kind == table:
+		if p.pos < len(p.line) && !p.blank {
+			p.addLineToTip()
+		}
+	case container.acceptsLines():
+		p.addLineToTip()
+		if container.kind == htmlBlock && container.htmlType <= 5 && htmlClose[container.htmlType].MatchString(p.line[p.pos:]) {
+			p.finalize(container, p.lineNumber)
+		}
+	case p.pos < len(p.line) && !p.blank:
+		p.addChild(paragraph)
+		p.advanceNextNonspace()
+		p.addLineToTip()
+	}
+}
+
+// continues says whether the line continues an open block: 0 if it does,
+// 1 if it doesn't, and 2 if it continued and also finished the block.
+func (p *parser) continues(b *block) int {
+	switch b.kind {
+	case document, list:
+		return 0
+	case blockQuote:
+		if !p.indented && peek(p.line, p.nextNonspace) == '>' {
+			p.advanceNextNonspace()
+			p.advanceOffset(1)
+			if isSpaceOrTab(peek(p.line, p.pos)) {
+				p.advanceOffset(1)
+			}
+			return 0
+		}
+		return 1
+	case item, footnoteDef:
+		switch {
+		case p.blank:
+			if len(b.children) == 0 {
+				return 1 // an item can start with at most one blank line
+			}
+			p.advanceNextNonspace()
+		case p.indent >= b.markerOffset+b.padding:
+			p.advanceOffset(b.markerOffset + b.padding)
+		default:
+			return 1
+		}
+		return 0
+	case heading, thematicBreak:
+		return 1
+	case codeBlock:
+		if b.fenced {
+			if p.indent <= 3 && peek(p.line, p.nextNonspace) == int(b.fenceChar) {
+				rest := p.line[p.nextNonspace:]
+				n := len(rest) - len(strings.TrimLeft(rest, string(b.fenceChar)))
+				if n >= b.fenceLen && isBlank(rest[n:]) {
+					p.finalize(b, p.lineNumber)
+					return 2
+				}
+			}
+			for i := b.fenceOffset; i > 0 && isSpaceOrTab(peek(p.line, p.pos)); i-- {
+				p.advanceOffset(1)
+			}
+			return 0
+		}
+		switch {
+		case p.indent >= 4:
+			p.advanceOffset(4)
+		case p.blank:
+			p.advanceNextNonspace()
+		default:
+			return 1
+		}
+		return 0
+	case htmlBlock:
+		if p.blank && (b.htmlType == 6 || b.htmlType == 7) {
+			return 1
+		}
+		return 0
+	case paragraph, table:
+		if p.blank {
+			return 1
+		}
+		return 0
+	}
+	return 1
+}
+
+func (p *parser) finalize(b *block, line int) {
+	above := b.parent
+	b.open = false
+	b.endLine = line
+	switch b.kind {
+	case paragraph:
+		text := strings.Join(b.lines, "\n")
+		for strings.HasPrefix(text, "[") {
+			n := p.parseReference(text)
+			if n == 0 {
+				break
+			}
+			text = text[n:]
+		}
+		if isBlank(text) {
+			b.remove()
+		}
+		b.content = text
+	case codeBlock:
+		if b.fenced {
+			if len(b.lines) > 0 {
+				b.info = unescapeString(strings.TrimSpace(b.lines[0]))
+				b.lines = b.lines[1:]
+			}
+		} else {
+			for len(b.lines) > 0 && isBlank(b.lines[len(b.lines)-1]) {
+				b.lines = b.lines[:len(b.lines)-1]
+			}
+		}
+		if len(b.lines) > 0 {
+			b.content = strings.Join(b.lines, "\n") + "\n"
+		}
+	case htmlBlock:
+		lines := b.lines
+		for len(lines) > 0 && isBlank(lines[len(lines)-1]) {
+			lines = lines[:len(lines)-1]
+		}
+		b.content = strings.Join(lines, "\n")
+	case list:
+		b.tight = true
+	items:
+		for _, it := range b.children {
+			if it.endsWithBlankLine() {
+				b.tight = false
+				break
+			}
+			// blank lines between an item's children count too
+			for _, sub := range it.children {
+				if sub.endsWithBlankLine() {
+					b.tight = false
+					break items
+				}
+			}
+		}
+		b.endLine = b.lastChild().endLine
+	case item, footnoteDef:
+		if last := b.lastChild(); last != nil {
+			b.endLine = last.endLine
+		} else {
+			b.endLine = b.startLine
+		}
+	case table:
+		for _, line := range b.lines {
+			row := splitRow(line)
+			for len(row) < len(b.header) {
+				row = append(row, "")
+			}
+			b.rows = append(b.rows, row[:len(b.header)])
+		}
+	}
+	p.tip = above
+}
+
+// finish closes every block still open at the end of the document.
+func (p *parser) finish() {
+	for p.tip != nil {
+		p.finalize(p.tip, p.lineNumber)
+	}
+}
+
+// parseReference reads a link reference definition from the start of s and
+// returns how much of s it used, or 0 if there isn't one.
+func (p *parser) parseReference(s string) int {
+	ip := &inlineParser{subject: s, refs: p.refs}
+	n := ip.parseLinkLabel()
+	if n == 0 || peek(s, n) != ':' {
+		return 0
+	}
+	label := s[:n]
+	ip.pos = n + 1
+	ip.spnl()
+	dest, ok := ip.parseLinkDestination()
+	if !ok {
+		return 0
+	}
+	beforeTitle := ip.pos
+	ip.spnl()
+	title := ""
+	if ip.pos != beforeTitle {
+		if t, ok := ip.parseLinkTitle(); ok {
+			title = t
+		} else {
+			ip.pos = beforeTitle
+		}
+	}
+	atLineEnd := true
+	ip.skipSpaces()
+	if ip.pos < len(s) && s[ip.pos] != '\n' {
+		if title == "" {
+			atLineEnd = false
+		} else {
+			// the "title" was really the start of the next line
+			title = ""
+			ip.pos = beforeTitle
+			ip.skipSpaces()
+			atLineEnd = ip.pos >= len(s) || s[ip.pos] == '\n'
+		}
+	}
+	if !atLineEnd {
+		return 0
+	}
+	if ip.pos < len(s) {
+		ip.pos++ // the newline
+	}
+	key := normalizeLabel(label[1 : len(label)-1])
+	if key == "" {
+		return 0
+	}
+	if _, ok := p.refs[key]; !ok {
+		p.refs[key] = ref{dest, title}
+	}
+	return ip.pos
+}
+
+var blockStarts = []func(*parser, *block) int{
+	blockQuoteStart,
+	atxHeadingStart,
+	fencedCodeStart,
+	htmlBlockStart,
+	tableStart,
+	setextHeadingStart,
+	thematicBreakStart,
+	footnoteStart,
+	listItemStart,
+	indentedCodeStart,
+}
+
+// Block starts return 0 for no match, 1 for a new container block and 2 for
+// a new leaf block.
+
+func blockQuoteStart(p *parser, container *block) int {
+	if p.indented || peek(p.line, p.nextNonspace) != '>' {
+		return 0
+	}
+	p.advanceNextNonspace()
+	p.advanceOffset(1)
+	if isSpaceOrTab(peek(p.line, p.pos)) {
+		p.advanceOffset(1)
+	}
+	p.closeUnmatched()
+	p.addChild(blockQuote)
+	return 1
+}
+
+var (
+	reATXHeading       = regexp.MustCompile(`^#{1,6}(?:[ \t]+|$)`)
+	reATXClosingOnly   = regexp.MustCompile(`^[ \t]*#+[ \t]*$`)
+	reATXClosing       = regexp.MustCompile(`[ \t]+#+[ \t]*$`)
+	reSetextHeading    = regexp.MustCompile(`^(?:=+|-+)[ \t]*$`)
+	reThematicBreak    = regexp.MustCompile(`^(?:(?:\*[ \t]*){3,}|(?:_[ \t]*){3,}|(?:-[ \t]*){3,})$`)
+	reFootnoteDef      = regexp.MustCompile(`^\[\^([^\]\s]+)\]:[ \t]*`)
+	reBulletMarker     = regexp.MustCompile(`^[*+-]`)
+	reOrderedMarker    = regexp.MustCompile(`^(\d{1,9})([.)])`)
+	reTableDelimiter   = regexp.MustCompile(`^\|?[ \t]*:?-+:?[ \t]*(?:\|[ \t]*:?-+:?[ \t]*)*\|?[ \t]*$`)
+	reTableAlignString = regexp.MustCompile(`^(:?)-+(:?)$`)
+)
+
+func atxHeadingStart(p *parser, container *block) int {
+	if p.indented {
+		return 0
+	}
+	m := reATXHeading.FindString(p.line[p.nextNonspace:])
+	if m == "" {
+		return 0
+	}
+	p.advanceNextNonspace()
+	p.advanceOffset(len(m))
+	p.closeUnmatched()
+	h := p.addChild(heading)
+	h.level = strings.Count(m, "#")
+	text := reATXClosingOnly.ReplaceAllString(p.line[p.pos:], "")
+	h.content = reATXClosing.ReplaceAllString(text, "")
+	p.advanceOffset(len(p.line) - p.pos)
+	return 2
+}
+
+func fencedCodeStart(p *parser, container *block) int {
+	if p.indented {
+		return 0
+	}
+	rest := p.line[p.nextNonspace:]
+	if len(rest) < 3 || (rest[0] != '`' && rest[0] != '~') {
+		return 0
+	}
+	fence := rest[0]
+	n := len(rest) - len(strings.TrimLeft(rest, string(fence)))
+	if n < 3 || (fence == '`' && strings.Contains(rest[n:], "`")) {
+		return 0
+	}
+	p.closeUnmatched()
+	c := p.addChild(codeBlock)
+	c.fenced = true
+	c.fenceChar = fence
+	c.fenceLen = n
+	c.fenceOffset = p.indent
+	p.advanceNextNonspace()
+	p.advanceOffset(n)
+	return 2
+}
+
+const (
+	tagName      = `[A-Za-z][A-Za-z0-9-]*`
+	attrName     = `[a-zA-Z_:][a-zA-Z0-9:._-]*`
+	attrValue    = `(?:[^"'=<>` + "`" + `\x00-\x20]+|'[^']*'|"[^"]*")`
+	attribute    = `(?:\s+` + attrName + `(?:\s*=\s*` + attrValue + `)?)`
+	openTag      = `<` + tagName + attribute + `*\s*/?>`
+	closeTag     = `</` + tagName + `\s*>`
+	blockTagList = `address|article|aside|base|basefont|blockquote|body|caption|center|col|colgroup|dd|details|dialog|dir|div|dl|dt|fieldset|figcaption|figure|footer|form|frame|frameset|h[1-6]|head|header|hr|html|iframe|legend|li|link|main|menu|menuitem|nav|noframes|ol|optgroup|option|p|param|search|section|summary|table|tbody|td|tfoot|th|thead|title|tr|track|ul`
+)
+
+// the seven kinds of HTML block, indexed from 1 like in the spec
+var (
+	htmlOpen = []*regexp.Regexp{
+		nil,
+		regexp.MustCompile(`(?i)^<(?:script|pre|textarea|style)(?:\s|>|$)`),
+		regexp.MustCompile(`^<!--`),
+		regexp.MustCompile(`^<[?]`),
+		regexp.MustCompile(`^<![A-Za-z]`),
+		regexp.MustCompile(`^<!\[CDATA\[`),
+		regexp.MustCompile(`(?i)^</?(?:` + blockTagList + `)(?:\s|/?>|$)`),
+		regexp.MustCompile(`(?i)^(?:` + openTag + `|` + closeTag + `)\s*$`),
+	}
+	htmlClose = []*regexp.Regexp{
+		nil,
+		regexp.MustCompile(`(?i)</(?:script|pre|textarea|style)>`),
+		regexp.MustCompile(`-->`),
+		regexp.MustCompile(`\?>`),
+		regexp.MustCompile(`>`),
+		regexp.MustCompile(`\]\]>`),
+	}
+)
+
+func htmlBlockStart(p *parser, container *block) int {
+	if p.indented || peek(p.line, p.nextNonspace) != '<' {
+		return 0
+	}
+	rest := p.line[p.nextNonspace:]
+	for t := 1; t <= 7; t++ {
+		// only the last kind can't interrupt a paragraph
+		if htmlOpen[t].MatchString(rest) && (t < 7 || (container.kind != paragraph && (p.allClosed || p.blank || p.tip.kind != paragraph))) {
+			p.closeUnmatched()
+			b := p.addChild(htmlBlock)
+			b.htmlType = t
+			return 2
+		}
+	}
+	return 0
+}
+
+// tableStart turns the last line of a paragraph into a table header when it's
+// followed by a delimiter row with the same number of cells.
+func tableStart(p *parser, container *block) int {
+	if p.indented || container.kind != paragraph || len(container.lines) == 0 {
+		return 0
+	}
+	rest := p.line[p.nextNonspace:]
+	if !reTableDelimiter.MatchString(rest) {
+		return 0
+	}
+	header := container.lines[len(container.lines)-1]
+	if !strings.Contains(header, "|") && !strings.Contains(rest, "|") {
+		return 0
+	}
+	cells := splitRow(header)
+	delims := splitRow(rest)
+	if len(cells) != len(delims) {
+		return 0
+	}
+	aligns := make([]string, len(delims))
+	for i, d := range delims {
+		m := reTableAlignString.FindStringSubmatch(d)
+		switch {
+		case m[1] != "" && m[2] != "":
+			aligns[i] = "center"
+		case m[1] != "":
+			aligns[i] = "left"
+		case m[2] != "":
+			aligns[i] = "right"
+		}
+	}
+	p.closeUnmatched()
+	container.lines = container.lines[:len(container.lines)-1]
+	if len(container.lines) == 0 {
+		p.tip = container.parent
+		container.remove()
+	} else {
+		p.finalize(container, p.lineNumber-2)
+	}
+	t := p.addChild(table)
+	t.startLine = p.lineNumber - 1
+	t.header = cells
+	t.aligns = aligns
+	p.advanceOffset(len(p.line) - p.pos)
+	return 2
+}
+
+// splitRow splits a table row on the pipes that aren't escaped.
+func splitRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+	var cells []string
+	var cell strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case line[i] == '|':
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(line[i])
+		}
+	}
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+func setextHeadingStart(p *parser, container *block) int {
+	if p.indented || container.kind != paragraph {
+		return 0
+	}
+	rest := p.line[p.nextNonspace:]
+	if !reSetextHeading.MatchString(rest) {
+		return 0
+	}
+	p.closeUnmatched()
+	text := strings.Join(container.lines, "\n")
+	for strings.HasPrefix(text, "[") {
+		n := p.parseReference(text)
+		if n == 0 {
+			break
+		}
+		text = text[n:]
+	}
+	if isBlank(text) {
+		container.lines = nil
+		return 0
+	}
+	h := &block{kind: heading, open: true, startLine: container.startLine, content: text, level: 2}
+	if rest[0] == '=' {
+		h.level = 1
+	}
+	container.replaceWith(h)
+	p.tip = h
+	p.advanceOffset(len(p.line) - p.pos)
+	return 2
+}
+
+func thematicBreakStart(p *parser, container *block) int {
+	if p.indented || !reThematicBreak.MatchString(p.line[p.nextNonspace:]) {
+		return 0
+	}
+	p.closeUnmatched()
+	p.addChild(thematicBreak)
+	p.advanceOffset(len(p.line) - p.pos)
+	return 2
+}
+
+func footnoteStart(p *parser, container *block) int {
+	if p.indented {
+		return 0
+	}
+	m := reFootnoteDef.FindStringSubmatch(p.line[p.nextNonspace:])
+	if m == nil {
+		return 0
+	}
+	p.closeUnmatched()
+	f := p.addChild(footnoteDef)
+	f.label = footnoteKey(m[1])
+	f.padding = 4
+	if _, ok := p.footnotes[f.label]; !ok {
+		p.footnotes[f.label] = f
+	}
+	p.advanceNextNonspace()
+	p.advanceOffset(len(m[0]))
+	return 1
+}
+
+func (p *parser) parseListMarker(container *block) (listData, bool) {
+	var d listData
+	if p.indent >= 4 {
+		return d, false
+	}
+	rest := p.line[p.nextNonspace:]
+	markerLen := 0
+	if m := reBulletMarker.FindString(rest); m != "" {
+		d.bullet = m[0]
+		markerLen = 1
+	} else if m := reOrderedMarker.FindStringSubmatch(rest); m != nil && (container.kind != paragraph || m[1] == "1") {
+		d.ordered = true
+		d.start, _ = strconv.Atoi(m[1])
+		d.delim = m[2][0]
+		markerLen = len(m[0])
+	} else {
+		return d, false
+	}
+	if c := peek(rest, markerLen); c != -1 && !isSpaceOrTab(c) {
+		return d, false
+	}
+	// an empty item can't interrupt a paragraph
+	if container.kind == paragraph && isBlank(rest[markerLen:]) {
+		return d, false
+	}
+	d.markerOffset = p.indent
+	p.advanceNextNonspace()
+	p.advanceOffset(markerLen)
+	p.line = p.line[:p.pos] + expandSpaces(p.line[p.pos:], p.pos)
+	spacesStart := p.pos
+	for p.pos-spacesStart < 5 && isSpaceOrTab(peek(p.line, p.pos)) {
+		p.advanceOffset(1)
+	}
+	spaces := p.pos - spacesStart
+	if spaces >= 5 || spaces < 1 || p.pos >= len(p.line) {
+		// the content starts one space after the marker (and code may follow)
+		d.padding = markerLen + 1
+		p.pos = spacesStart
+		if isSpaceOrTab(peek(p.line, p.pos)) {
+			p.advanceOffset(1)
+		}
+	} else {
+		d.padding = markerLen + spaces
+	}
+	return d, true
+}
+
+func listItemStart(p *parser, container *block) int {
+	if p.indented && container.kind != list {
+		return 0
+	}
+	d, ok := p.parseListMarker(container)
+	if !ok {
+		return 0
+	}
+	p.closeUnmatched()
+	if t := p.tip; t.kind != list || t.ordered != d.ordered || t.bullet != d.bullet || t.delim != d.delim {
+		l := p.addChild(list)
+		l.listData = d
+	}
+	it := p.addChild(item)
+	it.listData = d
+	return 1
+}
+
+func indentedCodeStart(p *parser, container *block) int {
+	if !p.indented || p.tip.kind == paragraph || p.blank {
+		return 0
+	}
+	p.advanceOffset(4)
+	p.closeUnmatched()
+	p.addChild(codeBlock)
+	return 2
+}
@@ -0,0 +1,346 @@
+package markdown
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type renderer struct {
+	opt       Options
+	refs      map[string]ref
+	footnotes map[string]*block
+	ids       map[string]int // heading ids used so far
+	notes     []string       // footnotes in the order they're first referenced
+	w         *bytes.Buffer
+}
+
+// parseInlines parses the text of every leaf block, now that all the link
+// reference definitions are known.
+func (r *renderer) parseInlines(b *block) {
+	ip := &inlineParser{refs: r.refs, footnotes: r.footnotes}
+	switch b.kind {
+	case paragraph, heading:
+		b.inlines = ip.parse(b.content)
+	case table:
+		b.cells = append(b.cells, r.parseRow(b.header))
+		for _, row := range b.rows {
+			b.cells = append(b.cells, r.parseRow(row))
+		}
+	}
+	for _, c := range b.children {
+		r.parseInlines(c)
+	}
+}
+
+func (r *renderer) parseRow(row []string) []*node {
+	cells := make([]*node, len(row))
+	for i, cell := range row {
+		ip := &inlineParser{refs: r.refs, footnotes: r.footnotes}
+		cells[i] = ip.parse(cell)
+	}
+	return cells
+}
+
+func (r *renderer) out(s string) {
+	r.w.WriteString(s)
+}
+
+// cr starts a new line unless we're already at the start of one.
+func (r *renderer) cr() {
+	if b := r.w.Bytes(); len(b) > 0 && b[len(b)-1] != '\n' {
+		r.w.WriteByte('\n')
+	}
+}
+
+func (r *renderer) render(b *block) {
+	r.block(b, false)
+}
+
+func (r *renderer) block(b *block, tight bool) {
+	switch b.kind {
+	case document:
+		r.children(b, false)
+	case paragraph:
+		if tight {
+			r.inlines(b.inlines)
+			return
+		}
+		r.cr()
+		r.out("<p>")
+		r.inlines(b.inlines)
+		r.out("</p>")
+		r.cr()
+	case heading:
+		tag := "h" + strconv.Itoa(b.level)
+		r.cr()
+		r.out("<" + tag)
+		if r.opt.HeadingIDs {
+			r.out(` id="` + escape(r.headingID(b.inlines)) + `"`)
+		}
+		r.out(">")
+		r.inlines(b.inlines)
+		r.out("</" + tag + ">")
+		r.cr()
+	case thematicBreak:
+		r.cr()
+		r.out("<hr />")
+		r.cr()
+	case codeBlock:
+		r.cr()
+		r.out("<pre><code")
+		if lang, _, _ := strings.Cut(b.info, " "); lang != "" {
+			r.out(` class="language-` + escape(lang) + `"`)
+		}
+		r.out(">" + escape(b.content) + "</code></pre>")
+		r.cr()
+	case htmlBlock:
+		r.cr()
+		switch r.opt.HTML {
+		case AllowHTML:
+			r.out(b.content)
+		case EscapeHTML:
+			r.out("<p>" + escape(b.content) + "</p>")
+		case OmitHTML:
+			r.out("<!-- raw HTML omitted -->")
+		}
+		r.cr()
+	case blockQuote:
+		r.cr()
+		r.out("<blockquote>")
+		r.cr()
+		r.children(b, false)
+		r.cr()
+		r.out("</blockquote>")
+		r.cr()
+	case list:
+		tag := "ul"
+		r.cr()
+		if b.ordered {
+			tag = "ol"
+			if b.start != 1 {
+				r.out(`<ol start="` + strconv.Itoa(b.start) + `">`)
+			} else {
+				r.out("<ol>")
+			}
+		} else {
+			r.out("<ul>")
+		}
+		r.cr()
+		for _, it := range b.children {
+			r.out("<li>")
+			r.children(it, b.tight)
+			r.out("</li>")
+			r.cr()
+		}
+		r.out("</" + tag + ">")
+		r.cr()
+	case table:
+		r.cr()
+		r.out("<table>\n<thead>\n")
+		r.row("th", b.aligns, b.cells[0])
+		r.out("</thead>\n")
+		if len(b.cells) > 1 {
+			r.out("<tbody>\n")
+			for _, row := range b.cells[1:] {
+				r.row("td", b.aligns, row)
+			}
+			r.out("</tbody>\n")
+		}
+		r.out("</table>")
+		r.cr()
+	case footnoteDef:
+		// rendered at the end, if anything refers to it
+	}
+}
+
+func (r *renderer) children(b *block, tight bool) {
+	for _, c := range b.children {
+		r.block(c, tight)
+	}
+}
+
+func (r *renderer) row(tag string, aligns []string, cells []*node) {
+	r.out("<tr>\n")
+	for i, c := range cells {
+		r.out("<" + tag)
+		if aligns[i] != "" {
+			r.out(` align="` + aligns[i] + `"`)
+		}
+		r.out(">")
+		r.inlines(c)
+		r.out("</" + tag + ">\n")
+	}
+	r.out("</tr>\n")
+}
+
+func (r *renderer) inlines(parent *node) {
+	for n := parent.first; n != nil; n = n.next {
+		r.inline(n)
+	}
+}
+
+func (r *renderer) inline(n *node) {
+	switch n.kind {
+	case textNode:
+		r.out(escape(n.text))
+	case softBreak:
+		r.out("\n")
+	case hardBreak:
+		r.out("<br />\n")
+	case codeSpan:
+		r.out("<code>" + escape(n.text) + "</code>")
+	case rawHTML:
+		switch r.opt.HTML {
+		case AllowHTML:
+			r.out(n.text)
+		case EscapeHTML:
+			r.out(escape(n.text))
+		case OmitHTML:
+			r.out("<!-- raw HTML omitted -->")
+		}
+	case emph:
+		r.out("<em>")
+		r.inlines(n)
+		r.out("</em>")
+	case strong:
+		r.out("<strong>")
+		r.inlines(n)
+		r.out("</strong>")
+	case link:
+		r.out(`<a href="` + escape(r.safeURL(n.dest, false)) + `"`)
+		if n.title != "" {
+			r.out(` title="` + escape(n.title) + `"`)
+		}
+		r.out(">")
+		r.inlines(n)
+		r.out("</a>")
+	case image:
+		r.out(`<img src="` + escape(r.safeURL(n.dest, true)) + `" alt="` + escape(plainText(n)) + `"`)
+		if n.title != "" {
+			r.out(` title="` + escape(n.title) + `"`)
+		}
+		r.out(" />")
+	case footnoteRef:
+		num := r.noteNumber(n.text)
+		id := "fnref-" + n.text
+		if r.ids[id] > 0 {
+			id += "-" + strconv.Itoa(r.ids[id]+1)
+		}
+		r.ids["fnref-"+n.text]++
+		r.out(`<sup class="footnote-ref"><a href="#fn-` + escape(n.text) + `" id="` + escape(id) + `">` + strconv.Itoa(num) + `</a></sup>`)
+	case backref:
+		r.out(` <a href="#fnref-` + escape(n.text) + `" class="footnote-backref">↩</a>`)
+	}
+}
+
+// safeURL drops javascript: and similar links unless raw HTML is allowed
+// anyway. Images may still use data: for the usual image types.
+func (r *renderer) safeURL(dest string, image bool) string {
+	if r.opt.HTML == AllowHTML {
+		return dest
+	}
+	lower := strings.ToLower(dest)
+	if image && (strings.HasPrefix(lower, "data:image/png") || strings.HasPrefix(lower, "data:image/gif") ||
+		strings.HasPrefix(lower, "data:image/jpeg") || strings.HasPrefix(lower, "data:image/webp")) {
+		return dest
+	}
+	for _, scheme := range []string{"javascript:", "vbscript:", "file:", "data:"} {
+		if strings.HasPrefix(lower, scheme) {
+			return ""
+		}
+	}
+	return dest
+}
+
+func (r *renderer) noteNumber(key string) int {
+	for i, k := range r.notes {
+		if k == key {
+			return i + 1
+		}
+	}
+	r.notes = append(r.notes, key)
+	return len(r.notes)
+}
+
+// renderFootnotes lists the footnotes that were referenced, each with a link
+// back to where it was first used. Footnotes can refer to other footnotes, so
+// the list may grow as it's rendered.
+func (r *renderer) renderFootnotes() {
+	if len(r.notes) == 0 {
+		return
+	}
+	r.cr()
+	r.out("<section class=\"footnotes\">\n<ol>\n")
+	for i := 0; i < len(r.notes); i++ {
+		key := r.notes[i]
+		def := r.footnotes[key]
+		r.out(`<li id="fn-` + escape(key) + `">`)
+		r.cr()
+		back := &node{kind: backref, text: key}
+		if last := def.lastChild(); last != nil && last.kind == paragraph {
+			last.inlines.appendChild(back)
+			r.children(def, false)
+		} else {
+			r.children(def, false)
+			r.inline(back)
+		}
+		r.cr()
+		r.out("</li>\n")
+	}
+	r.out("</ol>\n</section>\n")
+}
+
+// headingID makes a unique id for a heading out of its text.
+func (r *renderer) headingID(n *node) string {
+	var b strings.Builder
+	dash := false
+	for _, c := range strings.ToLower(plainText(n)) {
+		switch {
+		case unicode.IsLetter(c) || unicode.IsDigit(c):
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			dash = false
+			b.WriteRune(c)
+		case c == ' ' || c == '-' || c == '_':
+			dash = true
+		}
+	}
+	id := b.String()
+	if id == "" {
+		id = "section"
+	}
+	if n := r.ids[id]; n > 0 {
+		r.ids[id]++
+		id += "-" + strconv.Itoa(n)
+	} else {
+		r.ids[id] = 1
+	}
+	return id
+}
+
+// plainText is the text of an inline tree without any markup, e.g. for
+// image alt text.
+func plainText(n *node) string {
+	var b strings.Builder
+	for c := n.first; c != nil; c = c.next {
+		switch c.kind {
+		case textNode, codeSpan:
+			b.WriteString(c.text)
+		case softBreak, hardBreak:
+			b.WriteByte('\n')
+		case rawHTML, footnoteRef, backref:
+		default:
+			b.WriteString(plainText(c))
+		}
+	}
+	return b.String()
+}
+
+var escaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
@@ -0,0 +1,773 @@
+package markdown
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type nodeKind int
+
+const (
+	textNode nodeKind = iota
+	softBreak
+	hardBreak
+	codeSpan
+	rawHTML
+	emph
+	strong
+	link
+	image
+	footnoteRef
+	backref
+	inlineRoot
+)
+
+// node is an inline element. They form a doubly linked tree, because
+// emphasis is resolved after the fact by regrouping nodes.
+type node struct {
+	kind        nodeKind
+	text        string
+	dest, title string
+
+	parent, first, last, prev, next *node
+}
+
+func (n *node) appendChild(c *node) {
+	c.unlink()
+	c.parent = n
+	if n.last != nil {
+		n.last.next = c
+		c.prev = n.last
+	} else {
+		n.first = c
+	}
+	n.last = c
+}
+
+func (n *node) insertAfter(s *node) {
+	s.unlink()
+	s.next = n.next
+	if s.next != nil {
+		s.next.prev = s
+	}
+	s.prev = n
+	n.next = s
+	s.parent = n.parent
+	if s.next == nil && s.parent != nil {
+		s.parent.last = s
+	}
+}
+
+func (n *node) unlink() {
+	if n.prev != nil {
+		n.prev.next = n.next
+	} else if n.parent != nil {
+		n.parent.first = n.next
+	}
+	if n.next != nil {
+		n.next.prev = n.prev
+	} else if n.parent != nil {
+		n.parent.last = n.prev
+	}
+	n.parent, n.prev, n.next = nil, nil, nil
+}
+
+// delimiter is a run of * or _ that may open or close emphasis.
+type delimiter struct {
+	cc                    byte
+	numdelims, origdelims int
+	node                  *node
+	prev, next            *delimiter
+	canOpen, canClose     bool
+}
+
+// bracket is a [ or ![ that may start a link or image.
+type bracket struct {
+	node          *node
+	prev          *bracket
+	prevDelimiter *delimiter
+	index         int // where the [ is
+	image         bool
+	active        bool
+	bracketAfter  bool
+}
+
+type inlineParser struct {
+	subject    string
+	pos        int
+	refs       map[string]ref
+	footnotes  map[string]*block
+	delimiters *delimiter
+	brackets   *bracket
+}
+
+func (ip *inlineParser) parse(s string) *node {
+	ip.subject = strings.Trim(s, " \t\n")
+	ip.pos = 0
+	root := &node{kind: inlineRoot}
+	for ip.parseInline(root) {
+	}
+	ip.processEmphasis(nil)
+	return root
+}
+
+func (ip *inlineParser) peek() int {
+	return peek(ip.subject, ip.pos)
+}
+
+func text(s string) *node {
+	return &node{kind: textNode, text: s}
+}
+
+func (ip *inlineParser) parseInline(block *node) bool {
+	if ip.pos >= len(ip.subject) {
+		return false
+	}
+	c := ip.subject[ip.pos]
+	ok := false
+	switch c {
+	case '\n':
+		ok = ip.parseNewline(block)
+	case '\\':
+		ok = ip.parseBackslash(block)
+	case '`':
+		ok = ip.parseBackticks(block)
+	case '*', '_':
+		ok = ip.handleDelim(c, block)
+	case '[':
+		block.appendChild(text("["))
+		ip.addBracket(block.last, ip.pos, false)
+		ip.pos++
+		ok = true
+	case '!':
+		ok = ip.parseBang(block)
+	case ']':
+		ok = ip.parseCloseBracket(block)
+	case '<':
+		ok = ip.parseAutolink(block) || ip.parseHTMLTag(block)
+	case '&':
+		ok = ip.parseEntity(block)
+	default:
+		ok = ip.parseString(block)
+	}
+	if !ok {
+		ip.pos++
+		block.appendChild(text(string(c)))
+	}
+	return true
+}
+
+func isSpecial(c byte) bool {
+	switch c {
+	case '\n', '\\', '`', '*', '_', '[', ']', '!', '<', '&':
+		return true
+	}
+	return false
+}
+
+func (ip *inlineParser) parseString(block *node) bool {
+	start := ip.pos
+	for ip.pos < len(ip.subject) && !isSpecial(ip.subject[ip.pos]) {
+		ip.pos++
+	}
+	if ip.pos == start {
+		return false
+	}
+	block.appendChild(text(ip.subject[start:ip.pos]))
+	return true
+}
+
+// parseNewline makes a hard break of a newline after two or more spaces, and
+// a soft break otherwise.
+func (ip *inlineParser) parseNewline(block *node) bool {
+	ip.pos++
+	last := block.last
+	if last != nil && last.kind == textNode && strings.HasSuffix(last.text, " ") {
+		hard := strings.HasSuffix(last.text, "  ")
+		last.text = strings.TrimRight(last.text, " ")
+		if hard {
+			block.appendChild(&node{kind: hardBreak})
+		} else {
+			block.appendChild(&node{kind: softBreak})
+		}
+	} else {
+		block.appendChild(&node{kind: softBreak})
+	}
+	for ip.peek() == ' ' {
+		ip.pos++
+	}
+	return true
+}
+
+func isEscapable(c int) bool {
+	return c >= 0 && c < 128 && strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", byte(c)) >= 0
+}
+
+func (ip *inlineParser) parseBackslash(block *node) bool {
+	ip.pos++
+	switch c := ip.peek(); {
+	case c == '\n':
+		ip.pos++
+		block.appendChild(&node{kind: hardBreak})
+	case isEscapable(c):
+		ip.pos++
+		block.appendChild(text(string(rune(c))))
+	default:
+		block.appendChild(text(`\`))
+	}
+	return true
+}
+
+func (ip *inlineParser) parseBackticks(block *node) bool {
+	start := ip.pos
+	for ip.peek() == '`' {
+		ip.pos++
+	}
+	ticks := ip.pos - start
+	afterOpen := ip.pos
+	for {
+		i := strings.IndexByte(ip.subject[ip.pos:], '`')
+		if i < 0 {
+			break
+		}
+		ip.pos += i
+		closeStart := ip.pos
+		for ip.peek() == '`' {
+			ip.pos++
+		}
+		if ip.pos-closeStart == ticks {
+			code := strings.ReplaceAll(ip.subject[afterOpen:closeStart], "\n", " ")
+			if len(code) >= 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.Trim(code, " ") != "" {
+				code = code[1 : len(code)-1]
+			}
+			block.appendChild(&node{kind: codeSpan, text: code})
+			return true
+		}
+	}
+	// no matching run, so they're just backticks
+	ip.pos = afterOpen
+	block.appendChild(text(ip.subject[start:afterOpen]))
+	return true
+}
+
+func isPunct(r rune) bool {
+	return unicode.IsPunct(r) || unicode.IsSymbol(r)
+}
+
+func isWhitespace(r rune) bool {
+	return unicode.Is(unicode.Zs, r) || r == '\t' || r == '\n' || r == '\f' || r == '\r'
+}
+
+// scanDelims measures the run of c at pos and works out, from what's on
+// either side of it, whether it can open and/or close emphasis.
+func (ip *inlineParser) scanDelims(c byte) (n int, canOpen, canClose bool) {
+	start := ip.pos
+	for peek(ip.subject, start+n) == int(c) {
+		n++
+	}
+	before, after := '\n', '\n'
+	if start > 0 {
+		before, _ = utf8.DecodeLastRuneInString(ip.subject[:start])
+	}
+	if start+n < len(ip.subject) {
+		after, _ = utf8.DecodeRuneInString(ip.subject[start+n:])
+	}
+	afterSpace, afterPunct := isWhitespace(after), isPunct(after)
+	beforeSpace, beforePunct := isWhitespace(before), isPunct(before)
+	left := !afterSpace && (!afterPunct || beforeSpace || beforePunct)
+	right := !beforeSpace && (!beforePunct || afterSpace || afterPunct)
+	if c == '_' {
+		canOpen = left && (!right || beforePunct)
+		canClose = right && (!left || afterPunct)
+	} else {
+		canOpen, canClose = left, right
+	}
+	return n, canOpen, canClose
+}
+
+func (ip *inlineParser) handleDelim(c byte, block *node) bool {
+	n, canOpen, canClose := ip.scanDelims(c)
+	start := ip.pos
+	ip.pos += n
+	t := text(ip.subject[start:ip.pos])
+	block.appendChild(t)
+	if canOpen || canClose {
+		d := &delimiter{cc: c, numdelims: n, origdelims: n, node: t, prev: ip.delimiters, canOpen: canOpen, canClose: canClose}
+		if d.prev != nil {
+			d.prev.next = d
+		}
+		ip.delimiters = d
+	}
+	return true
+}
+
+func (ip *inlineParser) removeDelimiter(d *delimiter) {
+	if d.prev != nil {
+		d.prev.next = d.next
+	}
+	if d.next == nil {
+		ip.delimiters = d.prev
+	} else {
+		d.next.prev = d.prev
+	}
+}
+
+type bottomKey struct {
+	cc  byte
+	idx int
+}
+
+// processEmphasis matches up the delimiters above stackBottom, innermost
+// first, and wraps what's between each pair in emphasis.
+func (ip *inlineParser) processEmphasis(stackBottom *delimiter) {
+	bottoms := map[bottomKey]*delimiter{}
+	closer := ip.delimiters
+	for closer != nil && closer.prev != stackBottom {
+		closer = closer.prev
+	}
+	for closer != nil {
+		if !closer.canClose {
+			closer = closer.next
+			continue
+		}
+		key := bottomKey{closer.cc, closer.origdelims % 3}
+		if closer.canOpen {
+			key.idx += 3
+		}
+		bottom, ok := bottoms[key]
+		if !ok {
+			bottom = stackBottom
+		}
+		opener := closer.prev
+		found := false
+		for opener != nil && opener != stackBottom && opener != bottom {
+			// the "rule of 3": *foo**bar* isn't <em>foo</em><em>bar</em>
+			odd := (closer.canOpen || opener.canClose) && closer.origdelims%3 != 0 && (opener.origdelims+closer.origdelims)%3 == 0
+			if opener.cc == closer.cc && opener.canOpen && !odd {
+				found = true
+				break
+			}
+			opener = opener.prev
+		}
+		old := closer
+		if found {
+			use := 1
+			if closer.numdelims >= 2 && opener.numdelims >= 2 {
+				use = 2
+			}
+			opener.numdelims -= use
+			closer.numdelims -= use
+			opener.node.text = opener.node.text[:len(opener.node.text)-use]
+			closer.node.text = closer.node.text[:len(closer.node.text)-use]
+			e := &node{kind: emph}
+			if use == 2 {
+				e.kind = strong
+			}
+			for tmp := opener.node.next; tmp != nil && tmp != closer.node; {
+				next := tmp.next
+				e.appendChild(tmp)
+				tmp = next
+			}
+			opener.node.insertAfter(e)
+			// delimiters between the pair can't match anything now
+			if opener.next != closer {
+				opener.next = closer
+				closer.prev = opener
+			}
+			if opener.numdelims == 0 {
+				opener.node.unlink()
+				ip.removeDelimiter(opener)
+			}
+			if closer.numdelims == 0 {
+				closer.node.unlink()
+				next := closer.next
+				ip.removeDelimiter(closer)
+				closer = next
+			}
+		} else {
+			closer = closer.next
+			bottoms[key] = old.prev
+			if !old.canOpen {
+				ip.removeDelimiter(old)
+			}
+		}
+	}
+	for ip.delimiters != nil && ip.delimiters != stackBottom {
+		ip.removeDelimiter(ip.delimiters)
+	}
+}
+
+func (ip *inlineParser) addBracket(n *node, index int, image bool) {
+	if ip.brackets != nil {
+		ip.brackets.bracketAfter = true
+	}
+	ip.brackets = &bracket{node: n, prev: ip.brackets, prevDelimiter: ip.delimiters, index: index, image: image, active: true}
+}
+
+func (ip *inlineParser) removeBracket() {
+	ip.brackets = ip.brackets.prev
+}
+
+func (ip *inlineParser) parseBang(block *node) bool {
+	ip.pos++
+	if ip.peek() == '[' {
+		block.appendChild(text("!["))
+		ip.addBracket(block.last, ip.pos, true)
+		ip.pos++
+	} else {
+		block.appendChild(text("!"))
+	}
+	return true
+}
+
+// parseCloseBracket decides whether a ] closes a link, an image or a
+// footnote reference, and if so builds it from the nodes since the opener.
+func (ip *inlineParser) parseCloseBracket(block *node) bool {
+	ip.pos++
+	startpos := ip.pos
+	opener := ip.brackets
+	if opener == nil {
+		block.appendChild(text("]"))
+		return true
+	}
+	if !opener.active {
+		block.appendChild(text("]"))
+		ip.removeBracket()
+		return true
+	}
+	isImage := opener.image
+
+	if !isImage && peek(ip.subject, opener.index+1) == '^' && ip.peek() != '(' && ip.peek() != '[' {
+		key := footnoteKey(ip.subject[opener.index+2 : startpos-1])
+		if _, ok := ip.footnotes[key]; ok && key != "" {
+			ip.processEmphasis(opener.prevDelimiter)
+			for tmp := opener.node.next; tmp != nil; {
+				next := tmp.next
+				tmp.unlink()
+				tmp = next
+			}
+			block.appendChild(&node{kind: footnoteRef, text: key})
+			ip.removeBracket()
+			opener.node.unlink()
+			return true
+		}
+	}
+
+	var dest, title string
+	matched := false
+	savepos := ip.pos
+	if ip.peek() == '(' {
+		ip.pos++
+		ip.spnl()
+		if d, ok := ip.parseLinkDestination(); ok {
+			dest = d
+			ip.spnl()
+			if isWhitespace(rune(ip.subject[ip.pos-1])) {
+				if t, ok := ip.parseLinkTitle(); ok {
+					title = t
+				}
+			}
+			ip.spnl()
+			if ip.peek() == ')' {
+				ip.pos++
+				matched = true
+			}
+		}
+		if !matched {
+			ip.pos = savepos
+		}
+	}
+	if !matched {
+		// a reference link: [text][label], [label][] or [label]
+		beforeLabel := ip.pos
+		n := ip.parseLinkLabel()
+		label := ""
+		if n > 2 {
+			label = ip.subject[beforeLabel : beforeLabel+n]
+		} else if !opener.bracketAfter {
+			label = ip.subject[opener.index:startpos]
+		}
+		if n == 0 {
+			ip.pos = savepos
+		}
+		if label != "" {
+			if r, ok := ip.refs[normalizeLabel(label[1:len(label)-1])]; ok {
+				dest, title = r.dest, r.title
+				matched = true
+			}
+		}
+	}
+	if !matched {
+		ip.removeBracket()
+		ip.pos = startpos
+		block.appendChild(text("]"))
+		return true
+	}
+
+	n := &node{kind: link, dest: dest, title: title}
+	if isImage {
+		n.kind = image
+	}
+	for tmp := opener.node.next; tmp != nil; {
+		next := tmp.next
+		n.appendChild(tmp)
+		tmp = next
+	}
+	block.appendChild(n)
+	ip.processEmphasis(opener.prevDelimiter)
+	ip.removeBracket()
+	opener.node.unlink()
+	// links can't contain other links
+	if !isImage {
+		for b := ip.brackets; b != nil; b = b.prev {
+			if !b.image {
+				b.active = false
+			}
+		}
+	}
+	return true
+}
+
+// spnl skips spaces and at most one newline.
+func (ip *inlineParser) spnl() {
+	ip.skipSpaces()
+	if ip.peek() == '\n' {
+		ip.pos++
+		ip.skipSpaces()
+	}
+}
+
+func (ip *inlineParser) skipSpaces() {
+	for isSpaceOrTab(ip.peek()) {
+		ip.pos++
+	}
+}
+
+func (ip *inlineParser) parseLinkDestination() (string, bool) {
+	s := ip.subject
+	if ip.peek() == '<' {
+		for i := ip.pos + 1; i < len(s); i++ {
+			switch c := s[i]; {
+			case c == '\\' && isEscapable(peek(s, i+1)):
+				i++
+			case c == '>':
+				dest := s[ip.pos+1 : i]
+				ip.pos = i + 1
+				return normalizeURI(unescapeString(dest)), true
+			case c == '<' || c == '\n':
+				return "", false
+			}
+		}
+		return "", false
+	}
+	start := ip.pos
+	depth := 0
+scan:
+	for ip.pos < len(s) {
+		switch c := s[ip.pos]; {
+		case c == '\\' && isEscapable(peek(s, ip.pos+1)):
+			ip.pos += 2
+		case c == '(':
+			depth++
+			if depth > 32 {
+				return "", false
+			}
+			ip.pos++
+		case c == ')':
+			if depth == 0 {
+				break scan
+			}
+			depth--
+			ip.pos++
+		case c <= ' ' || c == 0x7f:
+			break scan
+		default:
+			ip.pos++
+		}
+	}
+	if (ip.pos == start && ip.peek() != ')') || depth != 0 {
+		ip.pos = start
+		return "", false
+	}
+	return normalizeURI(unescapeString(s[start:ip.pos])), true
+}
+
+func (ip *inlineParser) parseLinkTitle() (string, bool) {
+	s := ip.subject
+	var closer byte
+	switch ip.peek() {
+	case '"':
+		closer = '"'
+	case '\'':
+		closer = '\''
+	case '(':
+		closer = ')'
+	default:
+		return "", false
+	}
+	for i := ip.pos + 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && isEscapable(peek(s, i+1)):
+			i++
+		case c == closer:
+			title := s[ip.pos+1 : i]
+			ip.pos = i + 1
+			return unescapeString(title), true
+		case closer == ')' && c == '(':
+			return "", false
+		}
+	}
+	return "", false
+}
+
+// parseLinkLabel reads a [label] at pos and returns its length including the
+// brackets, or 0.
+func (ip *inlineParser) parseLinkLabel() int {
+	s := ip.subject
+	if ip.peek() != '[' {
+		return 0
+	}
+	for i := ip.pos + 1; i < len(s) && i-ip.pos <= 1000; i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '[':
+			return 0
+		case ']':
+			n := i + 1 - ip.pos
+			ip.pos = i + 1
+			return n
+		}
+	}
+	return 0
+}
+
+var (
+	reAutolink  = regexp.MustCompile(`^<[A-Za-z][A-Za-z0-9.+-]{1,31}:[^<>\x00-\x20]*>`)
+	reEmailLink = regexp.MustCompile(`^<[a-zA-Z0-9.!#$%&'*+/=?^_` + "`" + `{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*>`)
+	reHTMLTag   = regexp.MustCompile(`^(?:` + openTag + `|` + closeTag + `|<!-->|<!--->|<!--[\s\S]*?-->|[<][?][\s\S]*?[?][>]|<![A-Za-z]+[^>]*>|<!\[CDATA\[[\s\S]*?\]\]>)`)
+	reEntity    = regexp.MustCompile(`^&(?:#[xX][0-9a-fA-F]{1,6}|#[0-9]{1,7}|[A-Za-z][A-Za-z0-9]{1,31});`)
+)
+
+func (ip *inlineParser) parseAutolink(block *node) bool {
+	rest := ip.subject[ip.pos:]
+	dest := ""
+	m := reEmailLink.FindString(rest)
+	if m != "" {
+		dest = "mailto:" + m[1:len(m)-1]
+	} else if m = reAutolink.FindString(rest); m != "" {
+		dest = m[1 : len(m)-1]
+	} else {
+		return false
+	}
+	ip.pos += len(m)
+	l := &node{kind: link, dest: normalizeURI(dest)}
+	l.appendChild(text(m[1 : len(m)-1]))
+	block.appendChild(l)
+	return true
+}
+
+func (ip *inlineParser) parseHTMLTag(block *node) bool {
+	m := reHTMLTag.FindString(ip.subject[ip.pos:])
+	if m == "" {
+		return false
+	}
+	ip.pos += len(m)
+	block.appendChild(&node{kind: rawHTML, text: m})
+	return true
+}
+
+func (ip *inlineParser) parseEntity(block *node) bool {
+	m := reEntity.FindString(ip.subject[ip.pos:])
+	if m == "" {
+		return false
+	}
+	decoded := decodeEntity(m)
+	if decoded == "" {
+		return false
+	}
+	ip.pos += len(m)
+	block.appendChild(text(decoded))
+	return true
+}
+
+// decodeEntity returns the text an entity stands for, or "" if it isn't a
+// real one.
+func decodeEntity(e string) string {
+	s := html.UnescapeString(e)
+	if s == e {
+		return ""
+	}
+	if strings.HasPrefix(e, "&#") && (s == "\x00" || s == "") {
+		return "�"
+	}
+	return s
+}
+
+// unescapeString resolves backslash escapes and entities, for link
+// destinations, titles and code info strings.
+func unescapeString(s string) string {
+	if !strings.ContainsAny(s, `\&`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && isEscapable(peek(s, i+1)):
+			b.WriteByte(s[i+1])
+			i++
+		case s[i] == '&':
+			if m := reEntity.FindString(s[i:]); m != "" {
+				if d := decodeEntity(m); d != "" {
+					b.WriteString(d)
+					i += len(m) - 1
+					continue
+				}
+			}
+			b.WriteByte('&')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// normalizeURI percent-encodes what isn't allowed in a URL, leaving existing
+// escapes alone.
+func normalizeURI(uri string) string {
+	const hex = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(uri); i++ {
+		c := uri[i]
+		switch {
+		case c == '%' && i+2 < len(uri) && isHex(uri[i+1]) && isHex(uri[i+2]):
+			b.WriteString(uri[i : i+3])
+			i += 2
+		case c < 128 && (c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte(";/?:@&=+$,-_.!~*'()#", c) >= 0):
+			b.WriteByte(c)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&15])
+		}
+	}
+	return b.String()
+}
+
+func isHex(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+// normalizeLabel is how link labels are matched: case-insensitively, with
+// runs of whitespace collapsed.
+func normalizeLabel(s string) string {
+	return strings.ToUpper(strings.ToLower(strings.Join(strings.Fields(s), " ")))
+}
+
+// footnoteKey is normalizeLabel, but lower case since it ends up in ids.
+func footnoteKey(s string) string {
+	return strings.ToLower(normalizeLabel(s))
+}
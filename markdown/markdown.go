@@ -0,0 +1,49 @@
+// Package markdown renders CommonMark, plus the GitHub extensions our posts
+// use (tables and footnotes), to HTML.
+package markdown
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Policy says what to do with raw HTML in the source.
+type Policy int
+
+const (
+	AllowHTML  Policy = iota // pass it through, for trusted authors
+	EscapeHTML               // show it as text
+	OmitHTML                 // drop it, and links to javascript: and friends
+)
+
+type Options struct {
+	HTML       Policy
+	HeadingIDs bool // give headings ids made from their text, for linking
+}
+
+// Posts is how post bodies are rendered: our authors are trusted, and
+// headings get anchors.
+var Posts = Options{HTML: AllowHTML, HeadingIDs: true}
+
+// Render converts Markdown to HTML.
+func Render(src []byte, opt Options) []byte {
+	p := newParser()
+	text := strings.ReplaceAll(string(src), "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	text = strings.ReplaceAll(text, "\x00", "�")
+	lines := strings.Split(text, "\n")
+	if strings.HasSuffix(text, "\n") {
+		lines = lines[:len(lines)-1]
+	}
+	for _, line := range lines {
+		p.addLine(line)
+	}
+	p.finish()
+	r := renderer{opt: opt, refs: p.refs, footnotes: p.footnotes, ids: map[string]int{}}
+	r.parseInlines(p.doc)
+	var buf bytes.Buffer
+	r.w = &buf
+	r.render(p.doc)
+	r.renderFootnotes()
+	return buf.Bytes()
+}
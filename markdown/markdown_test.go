@@ -0,0 +1,177 @@
+package markdown
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+// testdata/spec.json holds examples from the CommonMark spec, section by
+// section, in the spec's own JSON format and numbered in file order. It's the
+// subset we're held to; go generate swaps in the whole spec.
+//go:generate curl -sSfo testdata/spec.json https://spec.commonmark.org/0.31.2/spec.json
+
+// specExample is one entry of spec.json.
+type specExample struct {
+	Markdown string `json:"markdown"`
+	HTML     string `json:"html"`
+	Example  int    `json:"example"`
+	Section  string `json:"section"`
+}
+
+// delimiterRow matches a table's header underline, e.g. "|:--|--:|".
+var delimiterRow = regexp.MustCompile(`(?m)^ {0,3}\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?\s*$`)
+
+// extension says why an example is rendered differently on purpose: tables
+// and footnotes are always on, and plain CommonMark reads their syntax as
+// paragraphs and links.
+func extension(e specExample) string {
+	switch {
+	case strings.Contains(e.Markdown, "|") && delimiterRow.MatchString(e.Markdown):
+		return "GFM table"
+	case strings.Contains(e.Markdown, "[^"):
+		return "footnote"
+	}
+	return ""
+}
+
+func TestSpec(t *testing.T) {
+	data, err := os.ReadFile("testdata/spec.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var examples []specExample
+	if err := json.Unmarshal(data, &examples); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range examples {
+		t.Run(fmt.Sprintf("%d", e.Example), func(t *testing.T) {
+			if why := extension(e); why != "" {
+				t.Skip("deliberate exception: " + why)
+			}
+			got := string(Render([]byte(e.Markdown), Options{HTML: AllowHTML}))
+			if got != e.HTML && normalize(got) != normalize(e.HTML) {
+				t.Errorf("%s, example %d\n%q\ngot  %q\nwant %q", e.Section, e.Example, e.Markdown, got, e.HTML)
+			}
+		})
+	}
+}
+
+// normalize irons out differences that don't matter in HTML, such as attribute
+// quoting and void element slashes, as the spec's own test runner does.
+func normalize(s string) string {
+	nodes, err := html.ParseFragment(strings.NewReader(s), &html.Node{Type: html.ElementNode, Data: "body"})
+	if err != nil {
+		return s
+	}
+	var b strings.Builder
+	for _, n := range nodes {
+		html.Render(&b, n)
+	}
+	return b.String()
+}
+
+// Spot checks of the basics, plus 0.31's rule for comments containing "--".
+var commonMark = []struct {
+	markdown, html string
+}{
+	{"\tfoo\tbaz\t\tbim\n", "<pre><code>foo\tbaz\t\tbim\n</code></pre>\n"},
+	{"- `one\n- two`\n", "<ul>\n<li>`one</li>\n<li>two`</li>\n</ul>\n"},
+	{"***\n---\n___\n", "<hr />\n<hr />\n<hr />\n"},
+	{"# foo\n## foo\n###### foo\n####### foo\n", "<h1>foo</h1>\n<h2>foo</h2>\n<h6>foo</h6>\n<p>####### foo</p>\n"},
+	{"Foo *bar*\n=========\n\nFoo *bar*\n---------\n", "<h1>Foo <em>bar</em></h1>\n<h2>Foo <em>bar</em></h2>\n"},
+	{"    a simple\n      indented code block\n", "<pre><code>a simple\n  indented code block\n</code></pre>\n"},
+	{"```\n<\n >\n```\n", "<pre><code>&lt;\n &gt;\n</code></pre>\n"},
+	{"~~~ruby startline=3 $%@#$\ndef foo(x)\n  return 3\nend\n~~~\n", "<pre><code class=\"language-ruby\">def foo(x)\n  return 3\nend\n</code></pre>\n"},
+	{"<table><tr><td>\n<pre>\n**Hello**,\n\n_world_.\n</pre>\n</td></tr></table>\n", "<table><tr><td>\n<pre>\n**Hello**,\n<p><em>world</em>.\n</pre></p>\n</td></tr></table>\n"},
+	{"[foo]: /url \"title\"\n\n[foo]\n", "<p><a href=\"/url\" title=\"title\">foo</a></p>\n"},
+	{"> # Foo\n> bar\n> baz\n", "<blockquote>\n<h1>Foo</h1>\n<p>bar\nbaz</p>\n</blockquote>\n"},
+	{"1.  A paragraph\n    with two lines.\n\n        indented code\n\n    > A block quote.\n", "<ol>\n<li>\n<p>A paragraph\nwith two lines.</p>\n<pre><code>indented code\n</code></pre>\n<blockquote>\n<p>A block quote.</p>\n</blockquote>\n</li>\n</ol>\n"},
+	{"- foo\n  - bar\n    - baz\n      - boo\n", "<ul>\n<li>foo\n<ul>\n<li>bar\n<ul>\n<li>baz\n<ul>\n<li>boo</li>\n</ul>\n</li>\n</ul>\n</li>\n</ul>\n</li>\n</ul>\n"},
+	{"- a\n- b\n\n- c\n", "<ul>\n<li>\n<p>a</p>\n</li>\n<li>\n<p>b</p>\n</li>\n<li>\n<p>c</p>\n</li>\n</ul>\n"},
+	{"`` foo ` bar ``\n", "<p><code>foo ` bar</code></p>\n"},
+	{"*foo bar*\n", "<p><em>foo bar</em></p>\n"},
+	{"a * foo bar*\n", "<p>a * foo bar*</p>\n"},
+	{"**foo*bar**\n", "<p><strong>foo*bar</strong></p>\n"},
+	{"*(*foo*)*\n", "<p><em>(<em>foo</em>)</em></p>\n"},
+	{"[link](/uri \"title\")\n", "<p><a href=\"/uri\" title=\"title\">link</a></p>\n"},
+	{"[link](</my uri>)\n", "<p><a href=\"/my%20uri\">link</a></p>\n"},
+	{"![foo *bar*](/url \"title\")\n", "<p><img src=\"/url\" alt=\"foo bar\" title=\"title\" /></p>\n"},
+	{"<http://foo.bar.baz>\n", "<p><a href=\"http://foo.bar.baz\">http://foo.bar.baz</a></p>\n"},
+	{"foo <!-- this is a --\ncomment - with hyphens -->\n", "<p>foo <!-- this is a --\ncomment - with hyphens --></p>\n"},
+	{"foo  \nbaz\n", "<p>foo<br />\nbaz</p>\n"},
+	{"foo\\\nbaz\n", "<p>foo<br />\nbaz</p>\n"},
+	{"&nbsp; &amp; &copy; &AElig; &Dcaron;\n", "<p>\u00a0 &amp; © Æ Ď</p>\n"},
+	{"\\!\\\"\\#\\$\\%\\&\\'\\(\\)\\*\\+\\,\\-\\.\\/\\:\\;\\<\\=\\>\\?\\@\\[\\\\\\]\\^\\_\\`\\{\\|\\}\\~\n", "<p>!&quot;#$%&amp;'()*+,-./:;&lt;=&gt;?@[\\]^_`{|}~</p>\n"},
+	{"[foo][bar]\n\n[bar]: /url \"title\"\n", "<p><a href=\"/url\" title=\"title\">foo</a></p>\n"},
+	{"*foo _bar* baz_\n", "<p><em>foo _bar</em> baz_</p>\n"},
+}
+
+func TestCommonMark(t *testing.T) {
+	for _, tt := range commonMark {
+		if got := string(Render([]byte(tt.markdown), Options{HTML: AllowHTML})); got != tt.html {
+			t.Errorf("Render(%q)\ngot  %q\nwant %q", tt.markdown, got, tt.html)
+		}
+	}
+}
+
+func TestExtensions(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown string
+		opt      Options
+		html     string
+	}{
+		{
+			name:     "table",
+			markdown: "| a | b |\n|:--|--:|\n| 1 | 2 |\n",
+			html:     "<table>\n<thead>\n<tr>\n<th align=\"left\">a</th>\n<th align=\"right\">b</th>\n</tr>\n</thead>\n<tbody>\n<tr>\n<td align=\"left\">1</td>\n<td align=\"right\">2</td>\n</tr>\n</tbody>\n</table>\n",
+		},
+		{
+			name:     "footnotes",
+			markdown: "Text[^1] and again[^1].\n\n[^1]: The note.\n",
+			html:     "<p>Text<sup class=\"footnote-ref\"><a href=\"#fn-1\" id=\"fnref-1\">1</a></sup> and again<sup class=\"footnote-ref\"><a href=\"#fn-1\" id=\"fnref-1-2\">1</a></sup>.</p>\n<section class=\"footnotes\">\n<ol>\n<li id=\"fn-1\">\n<p>The note. <a href=\"#fnref-1\" class=\"footnote-backref\">↩</a></p>\n</li>\n</ol>\n</section>\n",
+		},
+		{
+			name:     "heading ids",
+			markdown: "# Hello, World!\n\n## Hello, World!\n",
+			opt:      Posts,
+			html:     "<h1 id=\"hello-world\">Hello, World!</h1>\n<h2 id=\"hello-world-1\">Hello, World!</h2>\n",
+		},
+		{
+			name:     "fenced code language",
+			markdown: "```go\nfmt.Println()\n```\n",
+			html:     "<pre><code class=\"language-go\">fmt.Println()\n</code></pre>\n",
+		},
+		{
+			name:     "allow HTML",
+			markdown: "<div onclick=\"x\">hi</div>\n\n[x](javascript:alert(1)) <b>b</b>\n",
+			opt:      Options{HTML: AllowHTML},
+			html:     "<div onclick=\"x\">hi</div>\n<p><a href=\"javascript:alert(1)\">x</a> <b>b</b></p>\n",
+		},
+		{
+			name:     "escape HTML",
+			markdown: "<div onclick=\"x\">hi</div>\n\n[x](javascript:alert(1)) <b>b</b>\n",
+			opt:      Options{HTML: EscapeHTML},
+			html:     "<p>&lt;div onclick=&quot;x&quot;&gt;hi&lt;/div&gt;</p>\n<p><a href=\"\">x</a> &lt;b&gt;b&lt;/b&gt;</p>\n",
+		},
+		{
+			name:     "omit HTML",
+			markdown: "<div onclick=\"x\">hi</div>\n\n[x](javascript:alert(1)) <b>b</b>\n",
+			opt:      Options{HTML: OmitHTML},
+			html:     "<!-- raw HTML omitted -->\n<p><a href=\"\">x</a> <!-- raw HTML omitted -->b<!-- raw HTML omitted --></p>\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(Render([]byte(tt.markdown), tt.opt)); got != tt.html {
+				t.Errorf("got  %q\nwant %q", got, tt.html)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"siteserver/content"
+)
+
+func TestPostMeta(t *testing.T) {
+	ts := parseTemplates("views/")
+	site := content.MetaSite{URL: "https://alexshroyer.com", Name: "Alex Shroyer", Image: "/images/pfp.png"}
+	tests := []struct {
+		status  string
+		noindex bool
+	}{
+		{"published", false},
+		{"unlisted", true},
+		{"draft", true},
+	}
+	for _, tt := range tests {
+		p := content.Post{
+			ID: 1, Link: "floatver", Title: "FloatVer", Summary: "A versioning scheme.", Author: "alex",
+			Status: tt.status, Published: time.Date(2024, 7, 3, 0, 0, 0, 0, time.UTC),
+			Reactions: content.NewReactions("post", 1),
+		}
+		p.Meta = site.Post(p)
+		var b strings.Builder
+		if err := ts["post"].ExecuteTemplate(&b, "post", p); err != nil {
+			t.Fatal(err)
+		}
+		page := b.String()
+		// shared links get a preview whether or not the post is listed
+		for _, tag := range []string{
+			`<link rel="canonical" href="https://alexshroyer.com/posts/floatver">`,
+			`<meta property="og:title" content="FloatVer">`,
+			`<meta property="og:image" content="https://alexshroyer.com/images/pfp.png">`,
+			`<meta name="twitter:card" content="summary">`,
+			`<script type="application/ld+json">`,
+		} {
+			if !strings.Contains(page, tag) {
+				t.Errorf("%s post: missing %s", tt.status, tag)
+			}
+		}
+		if got := strings.Contains(page, `<meta name="robots" content="noindex">`); got != tt.noindex {
+			t.Errorf("%s post: noindex = %v, want %v", tt.status, got, tt.noindex)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package notify
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Notification is one entry in a user's on-site inbox.
+type Notification struct {
+	ID      int    `db:"id"`
+	Kind    string `db:"kind"` // "reply", "mention", "moderation", ...
+	Message string `db:"message"`
+	Link    string `db:"link"` // site-relative, may be empty
+	When    string `db:"when"`
+}
+
+// Emit puts a notification in username's inbox. Anything on the site that
+// wants to tell a user something should go through here.
+func Emit(pool *pgxpool.Pool, username, kind, message, link string) error {
+	query := `
+INSERT INTO notifications (user_id, kind, message, link)
+SELECT id, $2, $3, $4 FROM users WHERE username = $1`
+	_, err := pool.Exec(context.Background(), query, username, kind, message, link)
+	return err
+}
+
+// EmitAdmins notifies every admin, e.g. when something needs moderating.
+func EmitAdmins(pool *pgxpool.Pool, kind, message, link string) error {
+	query := `
+INSERT INTO notifications (user_id, kind, message, link)
+SELECT id, $1, $2, $3 FROM users WHERE is_admin`
+	_, err := pool.Exec(context.Background(), query, kind, message, link)
+	return err
+}
+
+func Unread(pool *pgxpool.Pool, username string, limit int) ([]Notification, error) {
+	query := `
+SELECT n.id, n.kind, n.message, n.link, time_format(n.created_at) AS when
+FROM notifications n
+JOIN users u ON n.user_id = u.id
+WHERE u.username = $1 AND n.read_at IS NULL
+ORDER BY n.created_at DESC
+LIMIT $2`
+	rows, err := pool.Query(context.Background(), query, username, limit)
+	if err != nil {
+		return []Notification{}, err
+	}
+	defer rows.Close()
+	return pgx.CollectRows(rows, pgx.RowToStructByName[Notification])
+}
+
+func UnreadCount(pool *pgxpool.Pool, username string) (int, error) {
+	count := 0
+	query := `
+SELECT count(*) FROM notifications n
+JOIN users u ON n.user_id = u.id
+WHERE u.username = $1 AND n.read_at IS NULL`
+	err := pool.QueryRow(context.Background(), query, username).Scan(&count)
+	return count, err
+}
+
+// MarkRead marks one of username's notifications read and returns where it points.
+func MarkRead(pool *pgxpool.Pool, username string, id int) (string, error) {
+	link := ""
+	query := `
+UPDATE notifications SET read_at = COALESCE(read_at, CURRENT_TIMESTAMP)
+WHERE id = $2 AND user_id = (SELECT id FROM users WHERE username = $1)
+RETURNING link`
+	err := pool.QueryRow(context.Background(), query, username, id).Scan(&link)
+	return link, err
+}
+
+func MarkAllRead(pool *pgxpool.Pool, username string) error {
+	query := `
+UPDATE notifications SET read_at = CURRENT_TIMESTAMP
+WHERE read_at IS NULL AND user_id = (SELECT id FROM users WHERE username = $1)`
+	_, err := pool.Exec(context.Background(), query, username)
+	return err
+}
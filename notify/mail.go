@@ -0,0 +1,60 @@
+package notify
+
+import (
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+type Mailer struct {
+	Addr     string // host:port of the SMTP server
+	User     string
+	Password string
+	From     string
+}
+
+func (m *Mailer) Enabled() bool {
+	return m != nil && m.Password != ""
+}
+
+// Send delivers a plain-text message. Without credentials (e.g. during local
+// development) the message is logged instead.
+func (m *Mailer) Send(to, subject, body, unsubscribe string) error {
+	if !m.Enabled() {
+		log.Printf("[mail disabled] to:%q subject:%q\n%s", to, subject, body)
+		return nil
+	}
+	to = headerValue(to)
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", headerValue(m.From))
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", headerValue(subject)))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	if unsubscribe != "" {
+		fmt.Fprintf(&msg, "List-Unsubscribe: <%s>\r\n", headerValue(unsubscribe))
+	}
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	host, _, err := net.SplitHostPort(m.Addr)
+	if err != nil {
+		return err
+	}
+	auth := smtp.PlainAuth("", m.User, m.Password, host)
+	return smtp.SendMail(m.Addr, auth, m.From, []string{to}, []byte(msg.String()))
+}
+
+// headerValue keeps a header on one line: a CR or LF in, say, a commenter's
+// name would otherwise start a header (or the body) of its own.
+func headerValue(s string) string {
+	return strings.Join(strings.FieldsFunc(s, func(r rune) bool {
+		return unicode.IsControl(r) || unicode.IsSpace(r)
+	}), " ")
+}
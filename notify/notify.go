@@ -0,0 +1,196 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"text/template"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Notifier struct {
+	pool    *pgxpool.Pool
+	mail    *Mailer
+	tmpl    *template.Template
+	siteURL string
+}
+
+func New(pool *pgxpool.Pool, mail *Mailer, templatePath, siteURL string) *Notifier {
+	return &Notifier{
+		pool:    pool,
+		mail:    mail,
+		tmpl:    template.Must(template.ParseFiles(templatePath)),
+		siteURL: siteURL,
+	}
+}
+
+type recipient struct {
+	Username   string `db:"username"`
+	Email      string `db:"email"`
+	Token      string `db:"token"`
+	Reason     string `db:"reason"` // "author", "thread" or "mention"
+	WantsEmail bool   `db:"wants_email"`
+}
+
+// CommentCreated tells the post's author and everyone else on the thread about
+// a new comment: always in their inbox, and by email if they asked for it.
+// Meant to run in its own goroutine.
+func (n *Notifier) CommentCreated(postID, commentID int, commenter, comment string) {
+	ctx := context.Background()
+	// make sure everyone involved has a prefs row (and so an unsubscribe token)
+	ensure := `
+INSERT INTO notification_prefs (user_id)
+SELECT author_id FROM posts WHERE id = $1
+UNION SELECT user_id FROM comments WHERE post_id = $1 AND user_id IS NOT NULL
+ON CONFLICT DO NOTHING`
+	if _, err := n.pool.Exec(ctx, ensure, postID); err != nil {
+		log.Print("notify.CommentCreated ensure prefs: ", err)
+		return
+	}
+	// anyone mentioned hears about it from Mentioned instead
+	query := `
+SELECT DISTINCT ON (u.id) u.username, u.email, np.unsubscribe_token::text AS token, r.reason,
+((r.reason = 'author' AND np.on_post_comment) OR (r.reason = 'thread' AND np.on_thread_reply)) AS wants_email
+FROM (SELECT author_id AS user_id, 1 AS rank, 'author' AS reason FROM posts WHERE id = $1
+      UNION ALL
+      SELECT user_id, 2, 'thread' FROM comments WHERE post_id = $1 AND user_id IS NOT NULL AND status = 'approved') r
+JOIN users u ON u.id = r.user_id
+JOIN notification_prefs np ON np.user_id = u.id
+WHERE u.username <> $2
+AND u.id NOT IN (SELECT user_id FROM mentions WHERE comment_id = $3)
+ORDER BY u.id, r.rank`
+	rows, err := n.pool.Query(ctx, query, postID, commenter, commentID)
+	if err != nil {
+		log.Print("notify.CommentCreated recipients: ", err)
+		return
+	}
+	recipients, err := pgx.CollectRows(rows, pgx.RowToStructByName[recipient])
+	if err != nil {
+		log.Print("notify.CommentCreated recipients: ", err)
+		return
+	}
+	var title, link string
+	err = n.pool.QueryRow(ctx, `SELECT title, link FROM posts WHERE id = $1`, postID).Scan(&title, &link)
+	if err != nil {
+		log.Print("notify.CommentCreated post: ", err)
+		return
+	}
+	for _, r := range recipients {
+		message := fmt.Sprintf("%s replied on %q", commenter, title)
+		if r.Reason == "author" {
+			message = fmt.Sprintf("%s commented on your post %q", commenter, title)
+		}
+		if err := Emit(n.pool, r.Username, "reply", message, fmt.Sprintf("/posts/%s#comment-%d", link, commentID)); err != nil {
+			log.Print("notify.Emit: ", err)
+		}
+		if !r.WantsEmail {
+			continue
+		}
+		data := struct {
+			recipient
+			Commenter   string
+			Comment     string
+			PostTitle   string
+			PostURL     string
+			Unsubscribe string
+			Settings    string
+		}{
+			recipient:   r,
+			Commenter:   commenter,
+			Comment:     comment,
+			PostTitle:   title,
+			PostURL:     n.siteURL + "/posts/" + link,
+			Unsubscribe: n.siteURL + "/unsubscribe/" + r.Token,
+			Settings:    n.siteURL + "/settings",
+		}
+		if err := n.send(r.Email, "comment", data, data.Unsubscribe); err != nil {
+			log.Printf("notify.CommentCreated send to %q: %v", r.Username, err)
+		}
+	}
+}
+
+// Mentioned tells everyone who was @mentioned in a comment, by email only if
+// they want that.
+func (n *Notifier) Mentioned(commentID int) {
+	ctx := context.Background()
+	ensure := `
+INSERT INTO notification_prefs (user_id)
+SELECT user_id FROM mentions WHERE comment_id = $1
+ON CONFLICT DO NOTHING`
+	if _, err := n.pool.Exec(ctx, ensure, commentID); err != nil {
+		log.Print("notify.Mentioned ensure prefs: ", err)
+		return
+	}
+	var commenter, comment, title, link string
+	query := `
+SELECT COALESCE(u.username, c.guest_name), c.content, p.title, p.link
+FROM comments c
+JOIN posts p ON c.post_id = p.id
+LEFT JOIN users u ON c.user_id = u.id
+WHERE c.id = $1`
+	err := n.pool.QueryRow(ctx, query, commentID).Scan(&commenter, &comment, &title, &link)
+	if err != nil {
+		log.Print("notify.Mentioned comment: ", err)
+		return
+	}
+	query = `
+SELECT u.username, u.email, np.unsubscribe_token::text AS token, 'mention' AS reason, np.on_mention AS wants_email
+FROM mentions m
+JOIN users u ON u.id = m.user_id
+JOIN notification_prefs np ON np.user_id = u.id
+WHERE m.comment_id = $1 AND u.username <> $2`
+	rows, err := n.pool.Query(ctx, query, commentID, commenter)
+	if err != nil {
+		log.Print("notify.Mentioned recipients: ", err)
+		return
+	}
+	recipients, err := pgx.CollectRows(rows, pgx.RowToStructByName[recipient])
+	if err != nil {
+		log.Print("notify.Mentioned recipients: ", err)
+		return
+	}
+	for _, r := range recipients {
+		postLink := fmt.Sprintf("/posts/%s#comment-%d", link, commentID)
+		if err := Emit(n.pool, r.Username, "mention", fmt.Sprintf("%s mentioned you on %q", commenter, title), postLink); err != nil {
+			log.Print("notify.Emit: ", err)
+		}
+		if !r.WantsEmail {
+			continue
+		}
+		data := struct {
+			recipient
+			Commenter   string
+			Comment     string
+			PostTitle   string
+			PostURL     string
+			Unsubscribe string
+			Settings    string
+		}{
+			recipient:   r,
+			Commenter:   commenter,
+			Comment:     comment,
+			PostTitle:   title,
+			PostURL:     n.siteURL + postLink,
+			Unsubscribe: n.siteURL + "/unsubscribe/" + r.Token,
+			Settings:    n.siteURL + "/settings",
+		}
+		if err := n.send(r.Email, "mention", data, data.Unsubscribe); err != nil {
+			log.Printf("notify.Mentioned send to %q: %v", r.Username, err)
+		}
+	}
+}
+
+// send renders "<name>-subject" and "<name>-body" from the email templates.
+func (n *Notifier) send(to, name string, data any, unsubscribe string) error {
+	var subject, body strings.Builder
+	if err := n.tmpl.ExecuteTemplate(&subject, name+"-subject", data); err != nil {
+		return err
+	}
+	if err := n.tmpl.ExecuteTemplate(&body, name+"-body", data); err != nil {
+		return err
+	}
+	return n.mail.Send(to, strings.TrimSpace(subject.String()), strings.TrimSpace(body.String())+"\n", unsubscribe)
+}
@@ -0,0 +1,50 @@
+package notify
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Prefs struct {
+	PostComment bool   `db:"on_post_comment"` // someone commented on my post
+	ThreadReply bool   `db:"on_thread_reply"` // someone commented on a post I commented on
+	Mention     bool   `db:"on_mention"`      // someone wrote @me in a comment
+	Token       string `db:"token"`           // for the unsubscribe link
+}
+
+// GetPrefs returns a user's notification settings, creating the defaults on first use.
+func GetPrefs(pool *pgxpool.Pool, username string) (Prefs, error) {
+	query := `
+INSERT INTO notification_prefs (user_id) VALUES ((SELECT id FROM users WHERE username = $1))
+ON CONFLICT (user_id) DO UPDATE SET user_id = EXCLUDED.user_id
+RETURNING on_post_comment, on_thread_reply, on_mention, unsubscribe_token::text AS token`
+	rows, err := pool.Query(context.Background(), query, username)
+	if err != nil {
+		return Prefs{}, err
+	}
+	defer rows.Close()
+	return pgx.CollectOneRow(rows, pgx.RowToStructByName[Prefs])
+}
+
+func SetPrefs(pool *pgxpool.Pool, username string, p Prefs) error {
+	query := `
+INSERT INTO notification_prefs (user_id, on_post_comment, on_thread_reply, on_mention)
+VALUES ((SELECT id FROM users WHERE username = $1), $2, $3, $4)
+ON CONFLICT (user_id) DO UPDATE SET
+on_post_comment = EXCLUDED.on_post_comment,
+on_thread_reply = EXCLUDED.on_thread_reply,
+on_mention = EXCLUDED.on_mention`
+	_, err := pool.Exec(context.Background(), query, username, p.PostComment, p.ThreadReply, p.Mention)
+	return err
+}
+
+// Unsubscribe turns off every email for whoever owns token.
+func Unsubscribe(pool *pgxpool.Pool, token string) (bool, error) {
+	query := `
+UPDATE notification_prefs SET on_post_comment = false, on_thread_reply = false, on_mention = false
+WHERE unsubscribe_token::text = $1`
+	tag, err := pool.Exec(context.Background(), query, token)
+	return tag.RowsAffected() > 0, err
+}
@@ -0,0 +1,599 @@
+package org
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var (
+	reKeyword  = regexp.MustCompile(`^\s*#\+(\w+):\s?(.*)$`)
+	reHeading  = regexp.MustCompile(`^(\*+)\s+(.*?)\s*$`)
+	reTodo     = regexp.MustCompile(`^(TODO|DONE)\s+`)
+	rePriority = regexp.MustCompile(`^\[#[A-Z0-9]\]\s*`)
+	reTags     = regexp.MustCompile(`\s+(:[\w@#%:]+:)$`)
+	rePlanning = regexp.MustCompile(`^\s*(SCHEDULED|DEADLINE|CLOSED):`)
+	reBegin    = regexp.MustCompile(`(?i)^\s*#\+begin_(\w+)(?:\s+(.*?))?\s*$`)
+	reDrawer   = regexp.MustCompile(`^\s*:([\w-]+):\s*$`)
+	reProperty = regexp.MustCompile(`^\s*:([\w-]+\+?):\s*(.*?)\s*$`)
+	reFixed    = regexp.MustCompile(`^\s*:(\s|$)`)
+	reRule     = regexp.MustCompile(`^\s*-{5,}\s*$`)
+	reTable    = regexp.MustCompile(`^\s*\|`)
+	reComment  = regexp.MustCompile(`^\s*#(\s|$)`)
+	reItem     = regexp.MustCompile(`^(\s*)([-+*]|\d+[.)])(?:\s+(.*))?$`)
+	reFootDef  = regexp.MustCompile(`^\[fn:([\w-]+)\]\s*(.*)$`)
+	reLatex    = regexp.MustCompile(`^\s*\\begin\{([\w*]+)\}`)
+	reCheckbox = regexp.MustCompile(`^\[([ X-])\]\s+`)
+	reAlign    = regexp.MustCompile(`^<([lrc]?)\d*>$`)
+)
+
+type renderer struct {
+	notes map[string][]string // footnote definitions by label
+	order []string            // footnote labels in the order they're first referenced
+	refs  map[string]int      // how many times each footnote has been referenced
+	ids   map[string]int      // heading ids used so far
+	anon  int
+}
+
+// section renders a whole file, wrapping each heading and everything under it
+// in an outline-N div the way Org's exporter does.
+func (r *renderer) section(b *strings.Builder, lines []string) {
+	var open []int
+	closeTo := func(level int) {
+		for len(open) > 0 && open[len(open)-1] >= level {
+			b.WriteString("</div>\n")
+			open = open[:len(open)-1]
+		}
+	}
+	for i := 0; i < len(lines); {
+		m := reHeading.FindStringSubmatch(lines[i])
+		if m == nil {
+			j := i
+			for j < len(lines) && !reHeading.MatchString(lines[j]) {
+				j++
+			}
+			r.blocks(b, lines[i:j])
+			i = j
+			continue
+		}
+		level := len(m[1])
+		title, todo, tags := splitHeading(m[2])
+		i++
+		for i < len(lines) && rePlanning.MatchString(lines[i]) {
+			i++
+		}
+		props := map[string]string{}
+		if i < len(lines) && strings.EqualFold(strings.TrimSpace(lines[i]), ":PROPERTIES:") {
+			i = drawer(lines, i, props)
+		}
+
+		// COMMENT and :noexport: subtrees aren't exported at all
+		skip := strings.HasPrefix(title, "COMMENT ") || title == "COMMENT"
+		for _, t := range tags {
+			skip = skip || t == "noexport"
+		}
+		if skip {
+			for i < len(lines) {
+				if h := reHeading.FindStringSubmatch(lines[i]); h != nil && len(h[1]) <= level {
+					break
+				}
+				i++
+			}
+			continue
+		}
+
+		closeTo(level)
+		if title == "Footnotes" {
+			// Org's footnote section; the definitions are listed at the end
+			continue
+		}
+		open = append(open, level)
+		id := props["CUSTOM_ID"]
+		if id == "" {
+			id = r.headingID(title)
+		}
+		n := min(level+1, 6)
+		b.WriteString(`<div id="outline-container-` + escape(id) + `" class="outline-` + strconv.Itoa(level+1) + `">` + "\n")
+		b.WriteString("<h" + strconv.Itoa(n) + ` id="` + escape(id) + `">`)
+		if todo != "" {
+			b.WriteString(`<span class="todo ` + todo + `">` + todo + "</span> ")
+		}
+		b.WriteString(r.inline(title))
+		if len(tags) > 0 {
+			b.WriteString(`&#xa0;&#xa0;&#xa0;<span class="tag">`)
+			for _, t := range tags {
+				b.WriteString(`<span class="` + escape(t) + `">` + escape(t) + "</span>")
+			}
+			b.WriteString("</span>")
+		}
+		b.WriteString("</h" + strconv.Itoa(n) + ">\n")
+	}
+	closeTo(0)
+}
+
+// splitHeading pulls the TODO keyword, priority cookie and tags off a heading.
+func splitHeading(s string) (title, todo string, tags []string) {
+	if m := reTodo.FindStringSubmatch(s); m != nil {
+		todo = m[1]
+		s = s[len(m[0]):]
+	}
+	s = rePriority.ReplaceAllString(s, "")
+	if m := reTags.FindStringSubmatchIndex(s); m != nil {
+		tags = splitKeywords(s[m[2]:m[3]])
+		s = s[:m[0]]
+	}
+	return strings.TrimSpace(s), todo, tags
+}
+
+// drawer reads a :NAME: … :END: drawer starting at lines[i] into props and
+// returns the index of the line after it.
+func drawer(lines []string, i int, props map[string]string) int {
+	for j := i + 1; j < len(lines); j++ {
+		if strings.EqualFold(strings.TrimSpace(lines[j]), ":END:") {
+			return j + 1
+		}
+		if m := reProperty.FindStringSubmatch(lines[j]); m != nil && props != nil {
+			key := strings.ToUpper(m[1])
+			if strings.HasSuffix(key, "+") {
+				key = strings.TrimSuffix(key, "+")
+				props[key] = strings.TrimSpace(props[key] + " " + m[2])
+			} else {
+				props[key] = m[2]
+			}
+		}
+	}
+	return i + 1 // not really a drawer
+}
+
+// blocks renders everything that isn't a heading: paragraphs, lists, tables,
+// #+BEGIN_… blocks and so on.
+func (r *renderer) blocks(b *strings.Builder, lines []string) {
+	caption := ""
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case strings.TrimSpace(line) == "":
+			i++
+		case reBegin.MatchString(line):
+			m := reBegin.FindStringSubmatch(line)
+			end := blockEnd(lines, i, m[1])
+			r.block(b, strings.ToLower(m[1]), m[2], lines[i+1:end])
+			i = min(end+1, len(lines))
+		case reKeyword.MatchString(line):
+			m := reKeyword.FindStringSubmatch(line)
+			switch strings.ToUpper(m[1]) {
+			case "HTML":
+				b.WriteString(m[2] + "\n")
+			case "CAPTION":
+				caption = m[2]
+			}
+			i++
+		case reComment.MatchString(line):
+			i++
+		case reDrawer.MatchString(line) && !strings.EqualFold(strings.TrimSpace(line), ":END:"):
+			i = drawer(lines, i, nil)
+		case reFixed.MatchString(line):
+			var text []string
+			for ; i < len(lines) && reFixed.MatchString(lines[i]); i++ {
+				s := strings.TrimLeft(lines[i], " \t")
+				text = append(text, strings.TrimPrefix(s[1:], " "))
+			}
+			b.WriteString(`<pre class="example">` + "\n" + escape(strings.Join(text, "\n")) + "\n</pre>\n")
+		case reRule.MatchString(line):
+			b.WriteString("<hr>\n")
+			i++
+		case reTable.MatchString(line):
+			j := i
+			for j < len(lines) && reTable.MatchString(lines[j]) {
+				j++
+			}
+			r.table(b, lines[i:j], caption)
+			caption = ""
+			for i = j; i < len(lines) && strings.HasPrefix(strings.ToUpper(strings.TrimSpace(lines[i])), "#+TBLFM:"); i++ {
+			}
+		case reLatex.MatchString(line):
+			env := reLatex.FindStringSubmatch(line)[1]
+			j := i
+			for j < len(lines) && !strings.Contains(lines[j], `\end{`+env+`}`) {
+				j++
+			}
+			j = min(j+1, len(lines))
+			// left as it is for MathJax
+			b.WriteString("<div>\n" + escape(strings.Join(lines[i:j], "\n")) + "\n</div>\n")
+			i = j
+		case reFootDef.MatchString(line):
+			m := reFootDef.FindStringSubmatch(line)
+			def := []string{m[2]}
+			blank := 0
+			for i++; i < len(lines); i++ {
+				if reFootDef.MatchString(lines[i]) {
+					break
+				}
+				if strings.TrimSpace(lines[i]) == "" {
+					if blank++; blank == 2 {
+						break
+					}
+				} else {
+					blank = 0
+				}
+				def = append(def, lines[i])
+			}
+			r.notes[m[1]] = def
+		case isItem(line):
+			i = r.list(b, lines, i)
+		default:
+			j := i + 1
+			for j < len(lines) && strings.TrimSpace(lines[j]) != "" && !startsBlock(lines[j]) {
+				j++
+			}
+			b.WriteString("<p>\n" + r.inline(strings.Join(trimLines(lines[i:j]), "\n")) + "\n</p>\n")
+			i = j
+		}
+	}
+}
+
+// startsBlock says whether a line interrupts a paragraph.
+func startsBlock(line string) bool {
+	return reBegin.MatchString(line) || reKeyword.MatchString(line) || reComment.MatchString(line) ||
+		reFixed.MatchString(line) || reRule.MatchString(line) || reTable.MatchString(line) ||
+		reLatex.MatchString(line) || reFootDef.MatchString(line) || isItem(line)
+}
+
+func isItem(line string) bool {
+	m := reItem.FindStringSubmatch(line)
+	// a star at the start of a line is a heading, not a bullet
+	return m != nil && !(m[2] == "*" && m[1] == "")
+}
+
+func trimLines(lines []string) []string {
+	out := make([]string, len(lines))
+	for i, l := range lines {
+		out[i] = strings.TrimSpace(l)
+	}
+	return out
+}
+
+// blockEnd finds the #+END_ line matching the block that starts at lines[i],
+// allowing for blocks of the same kind nested inside.
+func blockEnd(lines []string, i int, name string) int {
+	begin, end := "#+begin_"+strings.ToLower(name), "#+end_"+strings.ToLower(name)
+	depth := 0
+	for j := i + 1; j < len(lines); j++ {
+		l := strings.ToLower(strings.TrimSpace(lines[j]))
+		switch {
+		case l == end || strings.HasPrefix(l, end+" "):
+			if depth == 0 {
+				return j
+			}
+			depth--
+		case l == begin || strings.HasPrefix(l, begin+" "):
+			depth++
+		}
+	}
+	return len(lines)
+}
+
+func (r *renderer) block(b *strings.Builder, name, args string, lines []string) {
+	switch name {
+	case "src":
+		lang, params, _ := strings.Cut(args, " ")
+		if strings.Contains(params, ":exports none") || strings.Contains(params, ":exports results") {
+			return
+		}
+		class := "src"
+		if lang != "" {
+			class += " src-" + lang
+		}
+		b.WriteString(`<div class="org-src-container">` + "\n")
+		b.WriteString(`<pre class="` + escape(class) + `">` + escape(literal(lines)) + "</pre>\n</div>\n")
+	case "example":
+		b.WriteString(`<pre class="example">` + "\n" + escape(literal(lines)) + "\n</pre>\n")
+	case "quote":
+		b.WriteString("<blockquote>\n")
+		r.blocks(b, lines)
+		b.WriteString("</blockquote>\n")
+	case "center":
+		b.WriteString(`<div class="org-center">` + "\n")
+		r.blocks(b, lines)
+		b.WriteString("</div>\n")
+	case "verse":
+		var out []string
+		for _, l := range lines {
+			out = append(out, r.inline(strings.TrimRight(l, " \t")))
+		}
+		b.WriteString(`<p class="verse">` + "\n" + strings.Join(out, "<br>\n") + "\n</p>\n")
+	case "export":
+		if strings.EqualFold(strings.TrimSpace(args), "html") {
+			b.WriteString(strings.Join(lines, "\n") + "\n")
+		}
+	case "comment":
+	default:
+		// special blocks, e.g. #+BEGIN_ABSTRACT, become divs
+		b.WriteString(`<div class="` + escape(name) + `">` + "\n")
+		r.blocks(b, lines)
+		b.WriteString("</div>\n")
+	}
+}
+
+// literal is the contents of a src or example block: common indentation
+// removed, and the commas Org uses to escape "*" and "#+" lines dropped.
+func literal(lines []string) string {
+	indent := -1
+	for _, l := range lines {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		n := len(l) - len(strings.TrimLeft(l, " \t"))
+		if indent < 0 || n < indent {
+			indent = n
+		}
+	}
+	out := make([]string, len(lines))
+	for i, l := range lines {
+		if len(l) >= indent && indent > 0 {
+			l = l[indent:]
+		}
+		if strings.HasPrefix(l, ",*") || strings.HasPrefix(l, ",#+") {
+			l = l[1:]
+		}
+		out[i] = l
+	}
+	return strings.Join(out, "\n")
+}
+
+// list renders the list starting at lines[i] and returns the index of the
+// line after it. Items run on for as long as lines are indented past their
+// bullet; two blank lines in a row end the whole list.
+func (r *renderer) list(b *strings.Builder, lines []string, i int) int {
+	first := reItem.FindStringSubmatch(lines[i])
+	indent := len(first[1])
+	ordered := first[2][0] >= '0' && first[2][0] <= '9'
+	_, _, desc := strings.Cut(first[3], " :: ")
+	desc = desc || strings.HasSuffix(first[3], " ::")
+	desc = desc && !ordered
+
+	tag := "ul"
+	if ordered {
+		tag = "ol"
+	} else if desc {
+		tag = "dl"
+	}
+	b.WriteString("<" + tag + ` class="org-` + tag + `">` + "\n")
+	for i < len(lines) {
+		m := reItem.FindStringSubmatch(lines[i])
+		if m == nil || !isItem(lines[i]) || len(m[1]) != indent {
+			break
+		}
+		if o := m[2][0] >= '0' && m[2][0] <= '9'; o != ordered {
+			break
+		}
+		item := []string{m[3]}
+		j, blank := i+1, 0
+		for ; j < len(lines); j++ {
+			if strings.TrimSpace(lines[j]) == "" {
+				if blank++; blank == 2 {
+					break
+				}
+				continue
+			}
+			if len(lines[j])-len(strings.TrimLeft(lines[j], " \t")) <= indent {
+				break
+			}
+			blank = 0
+		}
+		end := j
+		for end > i+1 && strings.TrimSpace(lines[end-1]) == "" {
+			end--
+		}
+		item = append(item, dedent(lines[i+1:end])...)
+		r.item(b, item, desc)
+		i = j
+		if blank == 2 {
+			break
+		}
+	}
+	b.WriteString("</" + tag + ">\n")
+	return i
+}
+
+func (r *renderer) item(b *strings.Builder, lines []string, desc bool) {
+	head := lines[0]
+	check := ""
+	if m := reCheckbox.FindStringSubmatch(head); m != nil {
+		check = map[string]string{" ": "<code>[&#xa0;]</code> ", "X": "<code>[X]</code> ", "-": "<code>[-]</code> "}[m[1]]
+		head = head[len(m[0]):]
+	}
+	if desc {
+		term, rest, ok := strings.Cut(head, " :: ")
+		if !ok {
+			term, rest = strings.TrimSuffix(head, " ::"), ""
+		}
+		b.WriteString("<dt>" + check + r.inline(term) + "</dt><dd>")
+		check, head = "", rest
+	} else {
+		b.WriteString("<li>")
+	}
+
+	// the item's first paragraph goes in without a <p>
+	j := 1
+	for j < len(lines) && strings.TrimSpace(lines[j]) != "" && !startsBlock(lines[j]) {
+		j++
+	}
+	b.WriteString(check + r.inline(strings.Join(trimLines(append([]string{head}, lines[1:j]...)), "\n")))
+	if j < len(lines) {
+		b.WriteString("\n")
+		r.blocks(b, lines[j:])
+	}
+	if desc {
+		b.WriteString("</dd>\n")
+	} else {
+		b.WriteString("</li>\n")
+	}
+}
+
+func dedent(lines []string) []string {
+	indent := -1
+	for _, l := range lines {
+		if strings.TrimSpace(l) == "" {
+			continue
+		}
+		n := len(l) - len(strings.TrimLeft(l, " \t"))
+		if indent < 0 || n < indent {
+			indent = n
+		}
+	}
+	out := make([]string, len(lines))
+	for i, l := range lines {
+		if len(l) >= indent && indent > 0 {
+			l = l[indent:]
+		}
+		out[i] = l
+	}
+	return out
+}
+
+// table renders an Org table. Rule lines split the rows into groups, and the
+// first group is the header if there's more than one.
+func (r *renderer) table(b *strings.Builder, lines []string, caption string) {
+	var groups [][][]string
+	var aligns []string
+	var group [][]string
+	for _, l := range lines {
+		l = strings.TrimSpace(l)
+		if strings.HasPrefix(l, "|-") {
+			if len(group) > 0 {
+				groups = append(groups, group)
+				group = nil
+			}
+			continue
+		}
+		l = strings.TrimSuffix(strings.TrimPrefix(l, "|"), "|")
+		cells := trimLines(strings.Split(l, "|"))
+		if a, ok := alignRow(cells); ok {
+			aligns = a
+			continue
+		}
+		group = append(group, cells)
+	}
+	if len(group) > 0 {
+		groups = append(groups, group)
+	}
+
+	b.WriteString("<table>\n")
+	if caption != "" {
+		b.WriteString(`<caption class="t-above">` + r.inline(caption) + "</caption>\n")
+	}
+	for gi, g := range groups {
+		section, cell := "tbody", "td"
+		if gi == 0 && len(groups) > 1 {
+			section, cell = "thead", "th"
+		}
+		b.WriteString("<" + section + ">\n")
+		for _, row := range g {
+			b.WriteString("<tr>")
+			for ci, c := range row {
+				b.WriteString("<" + cell)
+				if ci < len(aligns) && aligns[ci] != "" {
+					b.WriteString(` class="org-` + aligns[ci] + `"`)
+				}
+				b.WriteString(">" + r.inline(c) + "</" + cell + ">")
+			}
+			b.WriteString("</tr>\n")
+		}
+		b.WriteString("</" + section + ">\n")
+	}
+	b.WriteString("</table>\n")
+}
+
+// alignRow recognises a row of <l>, <c> and <r> cookies.
+func alignRow(cells []string) ([]string, bool) {
+	aligns := make([]string, len(cells))
+	any := false
+	for i, c := range cells {
+		if c == "" {
+			continue
+		}
+		m := reAlign.FindStringSubmatch(c)
+		if m == nil {
+			return nil, false
+		}
+		any = true
+		aligns[i] = map[string]string{"l": "left", "c": "center", "r": "right"}[m[1]]
+	}
+	return aligns, any
+}
+
+// footnoteSection lists the footnotes that were referenced, each linking back
+// to where it was first used. Footnotes can refer to other footnotes, so the
+// list may grow as it's rendered.
+func (r *renderer) footnoteSection(b *strings.Builder) {
+	if len(r.order) == 0 {
+		return
+	}
+	b.WriteString(`<div id="footnotes">` + "\n" + `<h2 class="footnotes">Footnotes: </h2>` + "\n" + `<div id="text-footnotes">` + "\n")
+	for i := 0; i < len(r.order); i++ {
+		n := strconv.Itoa(i + 1)
+		var def strings.Builder
+		r.blocks(&def, r.notes[r.order[i]])
+		b.WriteString(`<div class="footdef"><sup><a id="fn.` + n + `" class="footnum" href="#fnr.` + n + `" role="doc-backlink">` + n + "</a></sup> ")
+		b.WriteString(`<div class="footpara" role="doc-footnote">` + def.String() + "</div></div>\n")
+	}
+	b.WriteString("</div>\n</div>\n")
+}
+
+// footnoteRef numbers a footnote reference and links it to its definition.
+func (r *renderer) footnoteRef(label string) string {
+	num := 0
+	for i, l := range r.order {
+		if l == label {
+			num = i + 1
+		}
+	}
+	if num == 0 {
+		r.order = append(r.order, label)
+		num = len(r.order)
+	}
+	n := strconv.Itoa(num)
+	id := "fnr." + n
+	if r.refs[label] > 0 {
+		id += "." + strconv.Itoa(r.refs[label]+1)
+	}
+	r.refs[label]++
+	return `<sup><a id="` + id + `" class="footref" href="#fn.` + n + `" role="doc-backlink">` + n + "</a></sup>"
+}
+
+var reLinkText = regexp.MustCompile(`\[\[(?:[^\]]*)\]\[([^\]]*)\]\]|\[\[([^\]]*)\]\]`)
+
+// headingID makes a unique id for a heading out of its text.
+func (r *renderer) headingID(title string) string {
+	id := slug(reLinkText.ReplaceAllString(title, "$1$2"))
+	if id == "" {
+		id = "section"
+	}
+	if n := r.ids[id]; n > 0 {
+		r.ids[id]++
+		id += "-" + strconv.Itoa(n)
+	} else {
+		r.ids[id] = 1
+	}
+	return id
+}
+
+func slug(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, c := range strings.ToLower(s) {
+		switch {
+		case unicode.IsLetter(c) || unicode.IsDigit(c):
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			dash = false
+			b.WriteRune(c)
+		case c == ' ' || c == '-' || c == '_':
+			dash = true
+		}
+	}
+	return b.String()
+}
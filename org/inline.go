@@ -0,0 +1,224 @@
+package org
+
+import (
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	reLink      = regexp.MustCompile(`^\[\[((?:[^\]\\]|\\.)+)\](?:\[((?:[^\]]|\][^\]])+)\])?\]`)
+	reFootRef   = regexp.MustCompile(`^\[fn:([\w-]*)(?::([^\]]*))?\]`)
+	reURL       = regexp.MustCompile(`^https?://[^\s<>\[\]"]+`)
+	reTimestamp = regexp.MustCompile(`^<\d{4}-\d{2}-\d{2}(?: [^>\n]*)?>`)
+	reSnippet   = regexp.MustCompile(`^@@(\w+):((?:[^@]|@[^@])*)@@`)
+	reImage     = regexp.MustCompile(`(?i)\.(png|jpe?g|gif|svg|webp)$`)
+)
+
+const (
+	emphPre  = " \t\n-('\"{"
+	emphPost = " \t\n-.,;:!?')}[\"\\"
+)
+
+var emphTags = map[byte][2]string{
+	'*': {"<b>", "</b>"},
+	'/': {"<i>", "</i>"},
+	'_': {`<span class="underline">`, "</span>"},
+	'+': {"<del>", "</del>"},
+	'=': {"<code>", "</code>"},
+	'~': {"<code>", "</code>"},
+}
+
+// inline renders a paragraph's worth of text: emphasis, links, footnote
+// references, LaTeX fragments and Org's special strings.
+func (r *renderer) inline(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		if n, html := r.inlineAt(s, i); n > 0 {
+			b.WriteString(html)
+			i += n
+			continue
+		}
+		switch rest := s[i:]; {
+		case strings.HasPrefix(rest, "---"):
+			b.WriteString("&#x2014;")
+			i += 3
+		case strings.HasPrefix(rest, "--"):
+			b.WriteString("&#x2013;")
+			i += 2
+		case strings.HasPrefix(rest, "..."):
+			b.WriteString("&#x2026;")
+			i += 3
+		default:
+			b.WriteString(escape(s[i : i+1]))
+			i++
+		}
+	}
+	return b.String()
+}
+
+// inlineAt tries to read a piece of markup at s[i], returning how much of s
+// it used and its HTML.
+func (r *renderer) inlineAt(s string, i int) (int, string) {
+	rest := s[i:]
+	switch s[i] {
+	case '[':
+		if m := reLink.FindStringSubmatch(rest); m != nil {
+			return len(m[0]), r.link(strings.ReplaceAll(m[1], `\]`, "]"), m[2])
+		}
+		if m := reFootRef.FindStringSubmatch(rest); m != nil && (m[1] != "" || m[2] != "") {
+			label := m[1]
+			if label == "" {
+				r.anon++
+				label = "anon-" + strconv.Itoa(r.anon)
+			}
+			if m[2] != "" {
+				r.notes[label] = []string{m[2]}
+			}
+			return len(m[0]), r.footnoteRef(label)
+		}
+	case '\\':
+		switch {
+		case strings.HasPrefix(rest, `\(`):
+			if end := strings.Index(rest, `\)`); end > 0 {
+				return end + 2, escape(rest[:end+2])
+			}
+		case strings.HasPrefix(rest, `\[`):
+			if end := strings.Index(rest, `\]`); end > 0 {
+				return end + 2, escape(rest[:end+2])
+			}
+		case strings.HasPrefix(rest, `\\`) && (len(rest) == 2 || rest[2] == '\n'):
+			return 2, "<br>"
+		}
+	case '$':
+		// $$…$$ is display maths, $…$ inline; MathJax wants \[…\] and \(…\)
+		if strings.HasPrefix(rest, "$$") {
+			if end := strings.Index(rest[2:], "$$"); end > 0 {
+				return end + 4, escape(`\[` + rest[2:end+2] + `\]`)
+			}
+		} else if end, ok := latexDollar(s, i); ok {
+			return end + 1 - i, escape(`\(` + s[i+1:end] + `\)`)
+		}
+	case '*', '/', '_', '+', '=', '~':
+		if end, ok := emphasis(s, i); ok {
+			tags, inner := emphTags[s[i]], s[i+1:end]
+			if s[i] == '=' || s[i] == '~' {
+				inner = escape(inner)
+			} else {
+				inner = r.inline(inner)
+			}
+			return end + 1 - i, tags[0] + inner + tags[1]
+		}
+	case 'h':
+		if i > 0 && isWordByte(s[i-1]) {
+			break
+		}
+		if m := reURL.FindString(rest); m != "" {
+			m = strings.TrimRight(m, ".,;:!?)'")
+			return len(m), `<a href="` + escape(m) + `">` + escape(m) + "</a>"
+		}
+	case '<':
+		if m := reTimestamp.FindString(rest); m != "" {
+			return len(m), `<span class="timestamp-wrapper"><span class="timestamp">` + escape(m) + "</span></span>"
+		}
+	case '@':
+		if m := reSnippet.FindStringSubmatch(rest); m != nil {
+			if strings.EqualFold(m[1], "html") {
+				return len(m[0]), m[2]
+			}
+			return len(m[0]), ""
+		}
+	}
+	return 0, ""
+}
+
+// emphasis finds the marker closing the one at s[i], following Org's rules
+// about what may come before and after, and letting it run over at most one
+// line break.
+func emphasis(s string, i int) (int, bool) {
+	m := s[i]
+	if i > 0 && !strings.ContainsRune(emphPre, rune(s[i-1])) {
+		return 0, false
+	}
+	if i+1 >= len(s) || isSpace(s[i+1]) {
+		return 0, false
+	}
+	lines := 0
+	for j := i + 2; j < len(s); j++ {
+		if s[j] == '\n' {
+			if lines++; lines > 1 {
+				return 0, false
+			}
+		}
+		if s[j] == m && !isSpace(s[j-1]) && (j+1 == len(s) || strings.ContainsRune(emphPost, rune(s[j+1]))) {
+			return j, true
+		}
+	}
+	return 0, false
+}
+
+// latexDollar finds the end of an inline $…$ fragment, which like emphasis
+// can't start or end next to a space, nor end before a letter or digit.
+func latexDollar(s string, i int) (int, bool) {
+	if i > 0 && s[i-1] == '$' || i+1 >= len(s) || isSpace(s[i+1]) || strings.IndexByte(".,;$", s[i+1]) >= 0 {
+		return 0, false
+	}
+	for j := i + 1; j < len(s); j++ {
+		if s[j] != '$' {
+			continue
+		}
+		if isSpace(s[j-1]) || strings.IndexByte(".,$", s[j-1]) >= 0 {
+			return 0, false
+		}
+		if j+1 < len(s) && isWordByte(s[j+1]) {
+			return 0, false
+		}
+		return j, true
+	}
+	return 0, false
+}
+
+// link renders [[target][description]]. Links to other .org files point at
+// the posts they become, links without a scheme point at headings, and image
+// links with no description are shown inline.
+func (r *renderer) link(target, desc string) string {
+	url := target
+	switch {
+	case strings.HasPrefix(target, "file:"):
+		url, _, _ = strings.Cut(strings.TrimPrefix(target, "file:"), "::")
+		if path.Ext(url) == ".org" {
+			url = "/posts/" + strings.TrimSuffix(path.Base(url), ".org")
+		}
+	case strings.HasPrefix(target, "#"):
+	case strings.HasPrefix(target, "*"):
+		url = "#" + slug(target[1:])
+	case !strings.Contains(target, ":") && !strings.HasPrefix(target, "/") && !strings.HasPrefix(target, "."):
+		url = "#" + slug(target)
+	}
+	if desc == "" {
+		if reImage.MatchString(url) {
+			return `<img src="` + escape(url) + `" alt="` + escape(path.Base(url)) + `">`
+		}
+		return `<a href="` + escape(url) + `">` + escape(target) + "</a>"
+	}
+	text := r.inline(desc)
+	if reImage.MatchString(desc) && !strings.ContainsAny(desc, " \t") {
+		text = `<img src="` + escape(strings.TrimPrefix(desc, "file:")) + `" alt="` + escape(path.Base(desc)) + `">`
+	}
+	return `<a href="` + escape(url) + `">` + text + "</a>"
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n'
+}
+
+func isWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
+
+var escaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
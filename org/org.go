@@ -0,0 +1,66 @@
+// Package org renders Org-mode documents to HTML, in roughly the shape Org's
+// own HTML export produces, and reads their #+KEYWORD metadata.
+package org
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Document is a parsed Org file.
+type Document struct {
+	Title       string
+	Date        string // as written, e.g. "<2024-03-10 Sun>"
+	Author      string
+	Description string
+	Keywords    []string          // from #+KEYWORDS and #+FILETAGS
+	Settings    map[string]string // every #+KEY: value line, keys upper-cased
+	HTML        []byte
+}
+
+var reDate = regexp.MustCompile(`\d{4}-\d{2}-\d{2}`)
+
+// Time is the document's #+DATE, if it has a usable one.
+func (d Document) Time() (time.Time, bool) {
+	t, err := time.Parse("2006-01-02", reDate.FindString(d.Date))
+	return t, err == nil
+}
+
+// Parse reads an Org document and renders its body. The title isn't part of
+// the body, since pages show it themselves.
+func Parse(src []byte) Document {
+	text := strings.ReplaceAll(string(src), "\r\n", "\n")
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	doc := Document{Settings: map[string]string{}}
+	for _, line := range lines {
+		m := reKeyword.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		key, val := strings.ToUpper(m[1]), strings.TrimSpace(m[2])
+		if prev, ok := doc.Settings[key]; ok && (key == "TITLE" || key == "DESCRIPTION" || key == "KEYWORDS") {
+			val = prev + " " + val // these can be continued over several lines
+		}
+		doc.Settings[key] = val
+	}
+	doc.Title = doc.Settings["TITLE"]
+	doc.Date = doc.Settings["DATE"]
+	doc.Author = doc.Settings["AUTHOR"]
+	doc.Description = doc.Settings["DESCRIPTION"]
+	doc.Keywords = append(splitKeywords(doc.Settings["KEYWORDS"]), splitKeywords(doc.Settings["FILETAGS"])...)
+
+	r := &renderer{notes: map[string][]string{}, refs: map[string]int{}, ids: map[string]int{}}
+	var b strings.Builder
+	r.section(&b, lines)
+	r.footnoteSection(&b)
+	doc.HTML = []byte(b.String())
+	return doc
+}
+
+// splitKeywords accepts "a, b", "a b" and ":a:b:".
+func splitKeywords(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ':' || r == ' ' || r == '\t'
+	})
+}
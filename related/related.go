@@ -0,0 +1,160 @@
+// Package related finds similar documents: TF-IDF cosine similarity over
+// their text, blended with how many tags they share.
+package related
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Doc is one document to compare. Title and Summary count for more than Body.
+type Doc struct {
+	ID      int
+	Title   string
+	Summary string
+	Body    string
+	Tags    []string
+}
+
+type Match struct {
+	ID    int
+	Score float64
+}
+
+// TagWeight is how much shared tags count, against 1-TagWeight for text.
+var TagWeight = 0.3
+
+// Compute returns, for each document, up to n others most like it, best first.
+// Documents with nothing in common aren't matched.
+func Compute(docs []Doc, n int) map[int][]Match {
+	vecs := vectors(docs)
+	out := map[int][]Match{}
+	for i, a := range docs {
+		var matches []Match
+		for j, b := range docs {
+			if i == j {
+				continue
+			}
+			score := (1-TagWeight)*dot(vecs[i], vecs[j]) + TagWeight*jaccard(a.Tags, b.Tags)
+			if score > 0 {
+				matches = append(matches, Match{ID: b.ID, Score: score})
+			}
+		}
+		sort.Slice(matches, func(x, y int) bool {
+			if matches[x].Score != matches[y].Score {
+				return matches[x].Score > matches[y].Score
+			}
+			return matches[x].ID > matches[y].ID
+		})
+		if len(matches) > n {
+			matches = matches[:n]
+		}
+		out[a.ID] = matches
+	}
+	return out
+}
+
+// vectors makes a unit-length TF-IDF vector for each document.
+func vectors(docs []Doc) []map[string]float64 {
+	counts := make([]map[string]float64, len(docs))
+	df := map[string]int{}
+	for i, d := range docs {
+		c := map[string]float64{}
+		for _, t := range tokens(d.Title) {
+			c[t] += 3
+		}
+		for _, t := range tokens(d.Summary) {
+			c[t] += 2
+		}
+		for _, t := range tokens(d.Body) {
+			c[t]++
+		}
+		for t := range c {
+			df[t]++
+		}
+		counts[i] = c
+	}
+	n := float64(len(docs))
+	for _, c := range counts {
+		var norm float64
+		for t, tf := range c {
+			// words in every document say nothing about which are alike
+			w := (1 + math.Log(tf)) * math.Log(n/float64(df[t]))
+			c[t] = w
+			norm += w * w
+		}
+		norm = math.Sqrt(norm)
+		for t := range c {
+			if norm == 0 {
+				delete(c, t)
+			} else {
+				c[t] /= norm
+			}
+		}
+	}
+	return counts
+}
+
+func dot(a, b map[string]float64) float64 {
+	if len(b) < len(a) {
+		a, b = b, a
+	}
+	var sum float64
+	for t, w := range a {
+		sum += w * b[t]
+	}
+	return sum
+}
+
+func jaccard(a, b []string) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	set := map[string]bool{}
+	for _, t := range a {
+		set[t] = true
+	}
+	shared, union := 0, len(set)
+	seen := map[string]bool{}
+	for _, t := range b {
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+		if set[t] {
+			shared++
+		} else {
+			union++
+		}
+	}
+	return float64(shared) / float64(union)
+}
+
+var stopwords = map[string]bool{}
+
+func init() {
+	for _, w := range strings.Fields(`about above after again against all also and any are because been
+before being below between both but can could did does doing down during each few for from further had
+has have having her here hers him his how into its itself just more most much not now off once only other
+our ours out over own same she should some such than that the their theirs them then there these they this
+those through too under until very was were what when where which while who whom why will with would you
+your yours one two get got use used using like make made way well`) {
+		stopwords[w] = true
+	}
+}
+
+// tokens splits text into lowercase words, leaving out short and common ones.
+func tokens(s string) []string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	out := words[:0]
+	for _, w := range words {
+		if len([]rune(w)) >= 3 && !stopwords[w] {
+			out = append(out, w)
+		}
+	}
+	return out
+}
@@ -0,0 +1,132 @@
+// Package rewrite post-processes post HTML before it's served: heading
+// anchors and a table of contents, image sizes, safer external links and
+// reading-time estimates.
+package rewrite
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"html/template"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Heading is a table of contents entry.
+type Heading struct {
+	Level int
+	ID    string
+	Text  string
+}
+
+// Page is a rewritten post body and what was learned along the way.
+type Page struct {
+	HTML    template.HTML
+	TOC     []Heading
+	Words   int
+	Minutes int // reading time
+}
+
+// Transform changes the parsed body in place, noting anything it finds in p.
+type Transform func(root *html.Node, p *Page)
+
+// Pipeline runs transforms over post bodies, remembering the result for each
+// distinct body.
+type Pipeline struct {
+	transforms []Transform
+	mu         sync.Mutex
+	cache      map[[32]byte]Page
+}
+
+// cacheSize bounds the cache; old bodies are rarely asked for again, so it's
+// simply emptied when full.
+const cacheSize = 500
+
+func New(transforms ...Transform) *Pipeline {
+	return &Pipeline{transforms: transforms, cache: map[[32]byte]Page{}}
+}
+
+// Render rewrites body, or returns the cached result for the same body.
+func (pl *Pipeline) Render(body template.HTML) (Page, error) {
+	key := sha256.Sum256([]byte(body))
+	pl.mu.Lock()
+	page, ok := pl.cache[key]
+	pl.mu.Unlock()
+	if ok {
+		return page, nil
+	}
+	page, err := pl.Rewrite(body)
+	if err != nil {
+		return Page{HTML: body}, err
+	}
+	pl.mu.Lock()
+	if len(pl.cache) >= cacheSize {
+		clear(pl.cache)
+	}
+	pl.cache[key] = page
+	pl.mu.Unlock()
+	return page, nil
+}
+
+// Rewrite runs the transforms without touching the cache, e.g. for previews.
+func (pl *Pipeline) Rewrite(body template.HTML) (Page, error) {
+	container := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}
+	nodes, err := html.ParseFragment(strings.NewReader(string(body)), container)
+	if err != nil {
+		return Page{HTML: body}, err
+	}
+	for _, n := range nodes {
+		container.AppendChild(n)
+	}
+	var page Page
+	for _, t := range pl.transforms {
+		t(container, &page)
+	}
+	var buf bytes.Buffer
+	for n := container.FirstChild; n != nil; n = n.NextSibling {
+		if err := html.Render(&buf, n); err != nil {
+			return Page{HTML: body}, err
+		}
+	}
+	page.HTML = template.HTML(buf.String())
+	return page, nil
+}
+
+func walk(n *html.Node, f func(*html.Node)) {
+	f(n)
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walk(c, f)
+	}
+}
+
+func getAttr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func setAttr(n *html.Node, key, val string) {
+	for i, a := range n.Attr {
+		if a.Key == key {
+			n.Attr[i].Val = val
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: key, Val: val})
+}
+
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(textContent(c))
+	}
+	return b.String()
+}
@@ -0,0 +1,161 @@
+package rewrite
+
+import (
+	"html/template"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestHeadingAnchors(t *testing.T) {
+	page, err := New(HeadingAnchors).Rewrite(`<h1>Title</h1>` +
+		`<h2>Setup</h2><h2 id="setup-1">Taken</h2><h3>Setup</h3><h2>  Set <em>up</em>! </h2><h2>?!</h2>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Heading{
+		{Level: 2, ID: "setup", Text: "Setup"},
+		{Level: 2, ID: "setup-1", Text: "Taken"},
+		{Level: 3, ID: "setup-2", Text: "Setup"},
+		{Level: 2, ID: "set-up", Text: "Set up!"},
+		{Level: 2, ID: "section", Text: "?!"},
+	}
+	if !reflect.DeepEqual(page.TOC, want) {
+		t.Errorf("TOC:\ngot  %+v\nwant %+v", page.TOC, want)
+	}
+	for _, s := range []string{
+		`<h1>Title</h1>`,
+		`<h2 id="setup">Setup <a class="anchor" href="#setup" aria-label="link to this section">#</a></h2>`,
+		`<h3 id="setup-2">Setup <a class="anchor" href="#setup-2"`,
+	} {
+		if !strings.Contains(string(page.HTML), s) {
+			t.Errorf("missing %s in\n%s", s, page.HTML)
+		}
+	}
+
+	// Org exports bring their own table of contents
+	page, err = New(HeadingAnchors).Rewrite(`<div id="table-of-contents"><h2>Contents</h2></div><h2 id="org1">One</h2>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.TOC != nil {
+		t.Errorf("TOC = %+v, want the page's own", page.TOC)
+	}
+	if strings.Contains(string(page.HTML), `<h2>Contents <a`) {
+		t.Errorf("the page's own table of contents got an anchor:\n%s", page.HTML)
+	}
+}
+
+func TestExternalLinks(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{`<a href="https://example.org/">x</a>`, `<a href="https://example.org/" rel="noopener">x</a>`},
+		{`<a href="//example.org/">x</a>`, `<a href="//example.org/" rel="noopener">x</a>`},
+		{`<a href="https://example.org/" rel="me">x</a>`, `<a href="https://example.org/" rel="me noopener">x</a>`},
+		{`<a href="https://example.org/" rel="noopener">x</a>`, `<a href="https://example.org/" rel="noopener">x</a>`},
+		{`<a href="https://ALEXSHROYER.com/posts/">x</a>`, `<a href="https://ALEXSHROYER.com/posts/">x</a>`},
+		{`<a href="/posts/floatver">x</a>`, `<a href="/posts/floatver">x</a>`},
+		{`<a href="#top">x</a>`, `<a href="#top">x</a>`},
+		{`<a>x</a>`, `<a>x</a>`},
+	}
+	pl := New(ExternalLinks("alexshroyer.com"))
+	for _, tt := range tests {
+		page, err := pl.Rewrite(template.HTML(tt.in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(page.HTML) != tt.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", tt.in, page.HTML, tt.want)
+		}
+	}
+}
+
+func TestImages(t *testing.T) {
+	dir := t.TempDir()
+	f, err := os.Create(filepath.Join(dir, "dot.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, image.NewGray(image.Rect(0, 0, 30, 20))); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	tests := []struct{ in, want string }{
+		{`<img src="/images/dot.png">`, `<img src="/images/dot.png" loading="lazy" width="30" height="20"/>`},
+		{`<img src="/images/dot.png?v=2" alt="">`, `<img src="/images/dot.png?v=2" alt="" loading="lazy" width="30" height="20"/>`},
+		{`<img src="/images/dot.png" width="15">`, `<img src="/images/dot.png" width="15" loading="lazy"/>`},
+		{`<img src="/images/dot.png" loading="eager">`, `<img src="/images/dot.png" loading="eager" width="30" height="20"/>`},
+		{`<img src="/images/missing.png">`, `<img src="/images/missing.png" loading="lazy"/>`},
+		{`<img src="/images/../images/dot.png">`, `<img src="/images/../images/dot.png" loading="lazy"/>`},
+		{`<img src="https://example.org/images/dot.png">`, `<img src="https://example.org/images/dot.png" loading="lazy"/>`},
+		{`<img src="/other/dot.png">`, `<img src="/other/dot.png" loading="lazy"/>`},
+	}
+	pl := New(Images(map[string]string{"/images/": dir}))
+	for _, tt := range tests {
+		page, err := pl.Rewrite(template.HTML(tt.in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(page.HTML) != tt.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", tt.in, page.HTML, tt.want)
+		}
+	}
+}
+
+func TestReadingTime(t *testing.T) {
+	tests := []struct {
+		body    string
+		words   int
+		minutes int
+	}{
+		{``, 0, 0},
+		{`<p>one two  three</p>`, 3, 1},
+		{`<h2>Four words right here</h2><p>and <em>six</em> more</p><pre>not counted at all</pre>` +
+			`<script>var x = 1</script><style>p { color: red }</style>`, 7, 1},
+		{`<p>` + strings.Repeat("word ", 230) + `</p>`, 230, 1},
+		{`<p>` + strings.Repeat("word ", 231) + `</p>`, 231, 2},
+	}
+	pl := New(ReadingTime)
+	for _, tt := range tests {
+		page, err := pl.Rewrite(template.HTML(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page.Words != tt.words || page.Minutes != tt.minutes {
+			t.Errorf("%.40s: %d words, %d minutes; want %d, %d", tt.body, page.Words, page.Minutes, tt.words, tt.minutes)
+		}
+	}
+}
+
+func TestRenderCaches(t *testing.T) {
+	calls := 0
+	count := func(root *html.Node, p *Page) { calls++ }
+	pl := New(ReadingTime, HeadingAnchors, ExternalLinks("alexshroyer.com"), count)
+	body := template.HTML(`<h2>Hi</h2><p>See <a href="https://example.org/">this</a>.</p>`)
+
+	want, err := pl.Rewrite(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		got, err := pl.Render(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Render:\ngot  %+v\nwant %+v", got, want)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("transforms ran %d times for one body, want once for Rewrite and once for Render", calls)
+	}
+	if _, err := pl.Render(body + " "); err != nil || calls != 3 {
+		t.Errorf("a different body was served from the cache")
+	}
+}
@@ -0,0 +1,205 @@
+package rewrite
+
+import (
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// HeadingAnchors gives every h2-h6 an id, if it lacks one, and a "#" link to
+// itself, and lists them all in the page's table of contents. Pages exported
+// from Org with their own table of contents keep that one instead.
+func HeadingAnchors(root *html.Node, p *Page) {
+	used := map[string]bool{}
+	var own *html.Node
+	walk(root, func(n *html.Node) {
+		if id := getAttr(n, "id"); id != "" {
+			used[id] = true
+		}
+		if getAttr(n, "id") == "table-of-contents" {
+			own = n
+		}
+	})
+	defer func() {
+		if own != nil {
+			p.TOC = nil
+		}
+	}()
+	walk(root, func(n *html.Node) {
+		level := headingLevel(n)
+		if level < 2 || (own != nil && inside(n, own)) {
+			return
+		}
+		text := strings.Join(strings.Fields(textContent(n)), " ")
+		id := getAttr(n, "id")
+		if id == "" {
+			id = slug(text)
+			for i := 1; used[id]; i++ {
+				id = slug(text) + "-" + strconv.Itoa(i)
+			}
+			used[id] = true
+			setAttr(n, "id", id)
+		}
+		p.TOC = append(p.TOC, Heading{Level: level, ID: id, Text: text})
+		n.AppendChild(&html.Node{Type: html.TextNode, Data: " "})
+		n.AppendChild(&html.Node{
+			Type: html.ElementNode, Data: "a", DataAtom: atom.A,
+			Attr: []html.Attribute{
+				{Key: "class", Val: "anchor"},
+				{Key: "href", Val: "#" + id},
+				{Key: "aria-label", Val: "link to this section"},
+			},
+			FirstChild: &html.Node{Type: html.TextNode, Data: "#"},
+		})
+	})
+}
+
+func inside(n, ancestor *html.Node) bool {
+	for ; n != nil; n = n.Parent {
+		if n == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
+func headingLevel(n *html.Node) int {
+	switch n.DataAtom {
+	case atom.H1:
+		return 1
+	case atom.H2:
+		return 2
+	case atom.H3:
+		return 3
+	case atom.H4:
+		return 4
+	case atom.H5:
+		return 5
+	case atom.H6:
+		return 6
+	}
+	return 0
+}
+
+func slug(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, c := range strings.ToLower(s) {
+		switch {
+		case unicode.IsLetter(c) || unicode.IsDigit(c):
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			dash = false
+			b.WriteRune(c)
+		default:
+			dash = true
+		}
+	}
+	if b.Len() == 0 {
+		return "section"
+	}
+	return b.String()
+}
+
+// Images lazy-loads images and, where the markup doesn't say, gives them the
+// size of the file they point at, so the page doesn't jump about as they load.
+// prefixes maps URL prefixes to directories, e.g. "/images/" to "static/images".
+func Images(prefixes map[string]string) Transform {
+	return func(root *html.Node, p *Page) {
+		walk(root, func(n *html.Node) {
+			if n.DataAtom != atom.Img {
+				return
+			}
+			if getAttr(n, "loading") == "" {
+				setAttr(n, "loading", "lazy")
+			}
+			if getAttr(n, "width") != "" || getAttr(n, "height") != "" {
+				return
+			}
+			if w, h, ok := imageSize(prefixes, getAttr(n, "src")); ok {
+				setAttr(n, "width", strconv.Itoa(w))
+				setAttr(n, "height", strconv.Itoa(h))
+			}
+		})
+	}
+}
+
+func imageSize(prefixes map[string]string, src string) (int, int, bool) {
+	u, err := url.Parse(src)
+	if err != nil || u.Host != "" {
+		return 0, 0, false
+	}
+	for prefix, dir := range prefixes {
+		rest, ok := strings.CutPrefix(u.Path, prefix)
+		if !ok || strings.Contains(rest, "..") {
+			continue
+		}
+		f, err := os.Open(filepath.Join(dir, filepath.FromSlash(rest)))
+		if err != nil {
+			return 0, 0, false
+		}
+		defer f.Close()
+		cfg, _, err := image.DecodeConfig(f)
+		if err != nil {
+			return 0, 0, false
+		}
+		return cfg.Width, cfg.Height, true
+	}
+	return 0, 0, false
+}
+
+// ExternalLinks adds rel="noopener" to links that leave the site.
+func ExternalLinks(host string) Transform {
+	return func(root *html.Node, p *Page) {
+		walk(root, func(n *html.Node) {
+			if n.DataAtom != atom.A {
+				return
+			}
+			u, err := url.Parse(getAttr(n, "href"))
+			if err != nil || u.Host == "" || strings.EqualFold(u.Hostname(), host) {
+				return
+			}
+			rel := strings.Fields(getAttr(n, "rel"))
+			for _, r := range rel {
+				if r == "noopener" {
+					return
+				}
+			}
+			setAttr(n, "rel", strings.Join(append(rel, "noopener"), " "))
+		})
+	}
+}
+
+// WordsPerMinute is the reading speed reading times are based on.
+var WordsPerMinute = 230
+
+// ReadingTime counts the words in the prose, leaving out code.
+func ReadingTime(root *html.Node, p *Page) {
+	var count func(*html.Node)
+	count = func(n *html.Node) {
+		switch n.DataAtom {
+		case atom.Pre, atom.Script, atom.Style:
+			return
+		}
+		if n.Type == html.TextNode {
+			p.Words += len(strings.Fields(n.Data))
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			count(c)
+		}
+	}
+	count(root)
+	p.Minutes = int(math.Ceil(float64(p.Words) / float64(WordsPerMinute)))
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"siteserver/gemtext"
+)
+
+// Usage:
+// go run html2gemtext.go < ../public/posts/some-post.html > some-post.gmi
+func main() {
+	doc, err := gemtext.FromHTML(os.Stdin, nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+	fmt.Print(doc)
+}
@@ -1,24 +1,52 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"flag"
 	"io/ioutil"
 	"log"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 
+	"siteserver/content"
+	"siteserver/gemtext"
+	"siteserver/markdown"
+	"siteserver/org"
+	"siteserver/webmention"
+
 	"github.com/jackc/pgx/v5/pgxpool"
 	"golang.org/x/net/html"
 )
 
+var (
+	importBodies = flag.Bool("import", false, "store post bodies in the database instead of serving them from disk")
+	sendMentions = flag.Bool("send-webmentions", false, "notify pages our posts link to")
+	siteURL      = flag.String("site", "https://alexshroyer.com", "public address of the site")
+)
+
+// relatedPosts is how many "read next" posts each post gets.
+const relatedPosts = 4
+
 // Usage:
-// go run indexPosts.go ../public/posts/
+// go run indexPosts.go [-import] [-send-webmentions] ../public/posts/
+// Posts are .html files, or .md, .org and .gmi files which are rendered to HTML.
+// Titles and dates come from file names like 2024-03-10-some-title.html,
+// except that .org files can set them with #+TITLE and #+DATE.
+// A post joins a series with <meta name="series" content="..."> and, optionally,
+// <meta name="series-part" content="3">, or #+SERIES and #+SERIES_PART in org.
+// Its preview image for shared links is <meta name="image" content="/images/x.png">
+// or #+IMAGE.
 func main() {
+	flag.Parse()
 	pool, err := pgxpool.New(context.Background(), "postgres://postgres@localhost:5432/mysite")
 	if err != nil {
 		log.Panic(err)
 	}
-	paths, err := os.ReadDir(os.Args[1])
+	paths, err := os.ReadDir(flag.Arg(0))
 	if err != nil {
 		log.Panic(err)
 	}
@@ -29,15 +57,54 @@ func main() {
 			log.Panic(err)
 		}
 	}
+	if err := content.UpdateRelated(pool, relatedPosts); err != nil {
+		log.Panic(err)
+	}
+}
+
+// sendWebmentions tells every external page linked from a post about the link.
+// Failures are only logged: most sites don't accept webmentions at all.
+func sendWebmentions(link string, htmlContent []byte) {
+	source := *siteURL + "/posts/" + link
+	base, err := url.Parse(source)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	targets, err := webmention.Links(bytes.NewReader(htmlContent), base)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	client := webmention.NewClient()
+	for _, target := range targets {
+		if u, _ := url.Parse(target); u.Host == base.Host {
+			continue
+		}
+		if err := client.Send(source, target); err != nil {
+			log.Printf("[webmention] %s: %v", target, err)
+		} else {
+			log.Printf("[webmention] sent to %s", target)
+		}
+	}
 }
 
 func addPost(pool *pgxpool.Pool, path os.DirEntry, author string) error {
 	nom := path.Name()
-	title := strings.Join(strings.Split(nom[:len(nom)-5], "-")[3:], " ")
-	date := nom[:10]
+	ext := filepath.Ext(nom)
+	if ext != ".html" && ext != ".md" && ext != ".org" && ext != ".gmi" {
+		return nil
+	}
+	link := strings.TrimSuffix(nom, ext)
+	var title, date, keywords, series, part, image string
+	if words := strings.Split(link, "-"); len(words) > 3 {
+		title = strings.Join(words[3:], " ")
+		date = nom[:10]
+	}
 	query := `
-	INSERT INTO posts (link, title, author_id, summary, created_at, updated_at)
-	VALUES ($1, $2, (SELECT id FROM users WHERE username = $3), $4, $5, $5)`
+	INSERT INTO posts (link, title, author_id, summary, created_at, updated_at, published_at)
+	VALUES ($1, $2, (SELECT id FROM users WHERE username = $3), $4, $5, $5, $5)
+	ON CONFLICT (link) DO UPDATE SET title = EXCLUDED.title, summary = EXCLUDED.summary`
 	file, err := os.Open("./public/posts/" + nom)
 	if err != nil {
 		log.Panic(err)
@@ -47,28 +114,96 @@ func addPost(pool *pgxpool.Pool, path os.DirEntry, author string) error {
 	if err != nil {
 		log.Panic(err)
 	}
+	description := ""
+	switch ext {
+	case ".md":
+		htmlContent = markdown.Render(htmlContent, markdown.Posts)
+	case ".gmi":
+		htmlContent = gemtext.Parse(htmlContent).HTML()
+	case ".org":
+		o := org.Parse(htmlContent)
+		htmlContent = o.HTML
+		if o.Title != "" {
+			title = o.Title
+		}
+		if t, ok := o.Time(); ok {
+			date = t.Format("2006-01-02")
+		}
+		keywords = strings.Join(o.Keywords, ",")
+		description = o.Description
+		series, part = o.Settings["SERIES"], o.Settings["SERIES_PART"]
+		image = o.Settings["IMAGE"]
+	}
+	if date == "" {
+		log.Printf("[skip] %s has no date", nom)
+		return nil
+	}
 	doc, err := html.Parse(strings.NewReader(string(htmlContent)))
 	if err != nil {
 		log.Panic(err)
 	}
 	summary := findNodeByClass(doc, "abstract")
-	if summary == nil {
+	if summary == nil && description == "" && ext != ".html" {
+		// only html posts are expected to have an abstract div, so use the first paragraph
+		summary = findNodeByTag(doc, "p")
+	}
+	if summary != nil {
+		description = extractText(summary)
+	} else if description == "" {
 		return nil
 	}
 	_, err = pool.Exec(
 		context.Background(),
 		query,
-		nom[:len(nom)-5],
+		link,
 		title,
 		author,
-		extractText(summary),
+		description,
 		date,
 	)
-	summ := extractText(summary)
+	summ := description
 	if len(summ) > 80 {
 		summ = summ[:80] + "..."
 	}
+	if err == nil {
+		var changed bool
+		changed, err = content.SaveRevision(pool, link, string(htmlContent), author)
+		if changed {
+			log.Printf("[revision] %s", nom)
+		}
+	}
+	if err == nil {
+		err = content.SetBodyText(pool, link, content.PlainText(string(htmlContent)))
+	}
+	if err == nil {
+		if keywords == "" {
+			keywords = findMeta(doc, "keywords")
+		}
+		// always set, so that removing a post's keywords removes its tags
+		err = content.SetTags(pool, link, content.ParseTags(keywords))
+	}
+	if err == nil {
+		if series == "" {
+			series, part = findMeta(doc, "series"), findMeta(doc, "series-part")
+		}
+		// an empty series takes the post out of the one it was in
+		n, _ := strconv.Atoi(part)
+		err = content.SetSeries(pool, link, series, n)
+	}
+	if err == nil {
+		if image == "" {
+			image = findMeta(doc, "image")
+		}
+		// always set, so that taking the image out of a post takes it off the site
+		err = content.SetImage(pool, link, image)
+	}
+	if err == nil && *importBodies {
+		err = content.SetBody(pool, link, string(htmlContent))
+	}
 	log.Printf("[OK] %s %s %s\n%#v", nom, title, date, summ)
+	if err == nil && *sendMentions {
+		sendWebmentions(link, htmlContent)
+	}
 	return err
 }
 
@@ -84,6 +219,18 @@ func extractText(n *html.Node) string {
 	return strings.TrimSpace(buf.String())
 }
 
+func findNodeByTag(n *html.Node, tag string) *html.Node {
+	if n.Type == html.ElementNode && n.Data == tag {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if result := findNodeByTag(c, tag); result != nil {
+			return result
+		}
+	}
+	return nil
+}
+
 func findNodeByClass(n *html.Node, className string) *html.Node {
 	if n.Type == html.ElementNode && n.Data == "div" {
 		for _, attr := range n.Attr {
@@ -105,3 +252,27 @@ func findNodeByClass(n *html.Node, className string) *html.Node {
 	}
 	return nil
 }
+
+// findMeta returns the content of <meta name="...">, e.g. the keywords org-mode exports.
+func findMeta(n *html.Node, name string) string {
+	if n.Type == html.ElementNode && n.Data == "meta" {
+		var key, val string
+		for _, attr := range n.Attr {
+			switch attr.Key {
+			case "name":
+				key = attr.Val
+			case "content":
+				val = attr.Val
+			}
+		}
+		if key == name {
+			return val
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if result := findMeta(c, name); result != "" {
+			return result
+		}
+	}
+	return ""
+}
@@ -5,6 +5,7 @@ id SERIAL PRIMARY KEY,
 username VARCHAR(50) UNIQUE NOT NULL,
 email VARCHAR(254) UNIQUE NOT NULL, -- 254 is not a typo
 password_hash VARCHAR(255) NOT NULL,
+is_admin BOOLEAN NOT NULL DEFAULT false,
 created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
 );
 
@@ -15,29 +16,199 @@ title VARCHAR(255) UNIQUE NOT NULL,
 author_id INTEGER NOT NULL,
 summary TEXT NOT NULL, -- metadata for link previews or "abstract/tl;dr" sections
 content TEXT, -- maybe null? could be a draft, or served from the filesystem..?
+status VARCHAR(10) NOT NULL DEFAULT 'published', -- 'draft', 'scheduled', 'published', or 'unlisted' (public but not listed)
+published_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP, -- when a scheduled post goes live
+body_text TEXT, -- plain text of the body, for search (kept up to date by the indexer)
+image TEXT, -- preview image for shared links, like /images/x.png; the site's default if null
+search tsvector GENERATED ALWAYS AS
+  (setweight(to_tsvector('english', title), 'A') ||
+   setweight(to_tsvector('english', summary), 'B') ||
+   setweight(to_tsvector('english', coalesce(body_text, '')), 'C')) STORED,
 created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
 updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
 FOREIGN KEY (author_id) REFERENCES users(id) -- post remains after author_id deleted
 );
+CREATE INDEX posts_search ON posts USING GIN (search);
+CREATE INDEX posts_listing ON posts (published_at DESC, id DESC) WHERE status = 'published'; -- keyset pages of /posts
+
+CREATE TABLE revisions (
+id SERIAL PRIMARY KEY,
+post_id INTEGER NOT NULL,
+hash CHAR(64) NOT NULL, -- sha256 of content, to skip saving the same body twice in a row
+content TEXT NOT NULL,
+author_id INTEGER, -- who indexed or restored it
+created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+FOREIGN KEY (author_id) REFERENCES users(id) ON DELETE SET NULL
+);
+CREATE INDEX revisions_post ON revisions (post_id, id);
+
+CREATE TABLE papers (
+id SERIAL PRIMARY KEY,
+file VARCHAR(75) UNIQUE NOT NULL, -- under static/papers
+title TEXT NOT NULL,
+abstract TEXT NOT NULL,
+published DATE NOT NULL,
+search tsvector GENERATED ALWAYS AS
+  (setweight(to_tsvector('english', title), 'A') || setweight(to_tsvector('english', abstract), 'B')) STORED
+);
+CREATE INDEX papers_search ON papers USING GIN (search);
+
+CREATE TABLE tags (
+id SERIAL PRIMARY KEY,
+name VARCHAR(50) UNIQUE NOT NULL -- lowercase-with-dashes
+);
+
+CREATE TABLE post_tags (
+post_id INTEGER NOT NULL,
+tag_id INTEGER NOT NULL,
+PRIMARY KEY (post_id, tag_id),
+FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE
+);
+
+CREATE TABLE series (
+id SERIAL PRIMARY KEY,
+slug VARCHAR(75) UNIQUE NOT NULL, -- lowercase-with-dashes, from the title
+title VARCHAR(255) NOT NULL,
+summary TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE series_posts (
+post_id INTEGER PRIMARY KEY, -- a post is in at most one series
+series_id INTEGER NOT NULL,
+position INTEGER NOT NULL, -- part number; ties go by publication date
+FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+FOREIGN KEY (series_id) REFERENCES series(id) ON DELETE CASCADE
+);
+CREATE INDEX series_posts_order ON series_posts (series_id, position);
+
+CREATE TABLE related_posts (
+post_id INTEGER NOT NULL,
+related_id INTEGER NOT NULL,
+score REAL NOT NULL, -- similarity, recomputed by the indexer
+PRIMARY KEY (post_id, related_id),
+FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+FOREIGN KEY (related_id) REFERENCES posts(id) ON DELETE CASCADE
+);
 
 CREATE TABLE comments (
 id SERIAL PRIMARY KEY,
 post_id INTEGER NOT NULL, -- comments belong to a post
-user_id INTEGER NOT NULL,
+user_id INTEGER, -- null for guest comments
+guest_name VARCHAR(50),
+guest_email VARCHAR(254),
 content TEXT NOT NULL,
+status VARCHAR(10) NOT NULL DEFAULT 'approved', -- 'pending' (awaiting moderation), 'approved', 'rejected', 'removed' (after a report), 'shadow' (only its author sees it)
+CHECK (user_id IS NOT NULL OR (guest_name IS NOT NULL AND guest_email IS NOT NULL)),
 created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
 updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
 FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE, -- delete user's comments if user deleted
 FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE -- delete post's comments if post deleted
 );
 
+CREATE TABLE reactions (
+id SERIAL PRIMARY KEY,
+user_id INTEGER NOT NULL,
+post_id INTEGER, -- exactly one of post_id or comment_id is set
+comment_id INTEGER,
+kind VARCHAR(16) NOT NULL,
+created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+CHECK ((post_id IS NULL) <> (comment_id IS NULL)),
+FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+FOREIGN KEY (comment_id) REFERENCES comments(id) ON DELETE CASCADE
+);
+-- one of each kind per user per post/comment
+CREATE UNIQUE INDEX reactions_post_user ON reactions (post_id, user_id, kind) WHERE post_id IS NOT NULL;
+CREATE UNIQUE INDEX reactions_comment_user ON reactions (comment_id, user_id, kind) WHERE comment_id IS NOT NULL;
+
+CREATE TABLE mentions (
+comment_id INTEGER NOT NULL,
+user_id INTEGER NOT NULL,
+PRIMARY KEY (comment_id, user_id),
+FOREIGN KEY (comment_id) REFERENCES comments(id) ON DELETE CASCADE,
+FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE notification_prefs (
+user_id INTEGER PRIMARY KEY,
+on_post_comment BOOLEAN NOT NULL DEFAULT true, -- someone commented on my post
+on_thread_reply BOOLEAN NOT NULL DEFAULT false, -- someone commented on a post I commented on
+on_mention BOOLEAN NOT NULL DEFAULT true, -- someone wrote @me in a comment
+unsubscribe_token UUID UNIQUE NOT NULL DEFAULT gen_random_uuid(),
+FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE webmentions (
+id SERIAL PRIMARY KEY,
+post_id INTEGER NOT NULL,
+source TEXT NOT NULL, -- the page that links to our post
+url TEXT NOT NULL, -- where to link back to (the h-entry's url, or source)
+author_name TEXT NOT NULL DEFAULT '',
+author_url TEXT NOT NULL DEFAULT '',
+content TEXT NOT NULL DEFAULT '',
+published TEXT NOT NULL DEFAULT '',
+verified BOOLEAN NOT NULL DEFAULT false, -- false until the source has been fetched and checked
+created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+UNIQUE (post_id, source),
+FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE
+);
+
+CREATE TABLE notifications (
+id SERIAL PRIMARY KEY,
+user_id INTEGER NOT NULL,
+kind VARCHAR(20) NOT NULL, -- 'reply', 'mention', 'moderation', ...
+message TEXT NOT NULL,
+link TEXT NOT NULL DEFAULT '', -- where clicking the notification goes
+read_at TIMESTAMPTZ, -- null until read
+created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX notifications_unread ON notifications (user_id) WHERE read_at IS NULL;
+
+CREATE TABLE reports (
+id SERIAL PRIMARY KEY,
+comment_id INTEGER NOT NULL,
+reporter_id INTEGER NOT NULL,
+reason TEXT NOT NULL DEFAULT '',
+resolution VARCHAR(10), -- null while open, then 'dismissed' or 'removed'
+created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+resolved_at TIMESTAMPTZ,
+UNIQUE (comment_id, reporter_id), -- one report per reader per comment
+FOREIGN KEY (comment_id) REFERENCES comments(id) ON DELETE CASCADE,
+FOREIGN KEY (reporter_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE sanctions (
+id SERIAL PRIMARY KEY,
+user_id INTEGER NOT NULL,
+kind VARCHAR(10) NOT NULL, -- 'mute' (can't comment), 'ban' (can't log in), 'shadowban' (comments only visible to themselves)
+reason TEXT NOT NULL DEFAULT '',
+expires_at TIMESTAMPTZ, -- null means permanent
+created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
 -- dummy values
-INSERT INTO users (username, email, password_hash) VALUES
-('alex_shroyer', 'contact@alexshroyer.com', 'hashed_password'),
+INSERT INTO users (username, email, password_hash, is_admin) VALUES
+('alex_shroyer', 'contact@alexshroyer.com', 'hashed_password', true),
 -- ('john_doe', 'john@example.com', 'hashed_password_1'),
 -- ('jane_smith', 'jane@example.com', 'hashed_password_2'),
 -- ('bob_johnson', 'bob@example.com', 'hashed_password_3'),
-('asdf', 'asdf@example.com', '$argon2id$v=19$m=65536,t=1,p=8$B2fUdx6ah7LERGAwXD0ZVQ$cQ2GO2RkxkN5wZiWWdFJl97MbbDoRA89IcYlaAXsbrc');
+('asdf', 'asdf@example.com', '$argon2id$v=19$m=65536,t=1,p=8$B2fUdx6ah7LERGAwXD0ZVQ$cQ2GO2RkxkN5wZiWWdFJl97MbbDoRA89IcYlaAXsbrc', false);
+
+-- papers are served from static/papers
+INSERT INTO papers (file, title, published, abstract) VALUES
+('intellisys2023.pdf', 'Detecting Standard Library Functions in Obfuscated Code', '2023-09-01',
+ 'Binary analysis helps find low-level system bugs in embed- ded systems, middleware, and Internet of Things (IoT) devices. However, obfuscation makes static analysis more challenging. In this work we use machine learning to detect standard library functions in compiled code which has been heavily obfuscated. First we create a C library func- tion dataset augmented by obfuscation and diverse compiler options. We then train an ensemble of Paragraph Vector-Distributed Memory (PV- DM) models on this dataset, and combine their predictions with simple majority voting. Although the average accuracy of individual PV-DM classifiers is 68%, the ensemble is 74% accurate. Finally, we train a sepa- rate model on the graph structure of the disassembled data. This graph classifier is 64% accurate on its own, but does not improve accuracy when added to the ensemble. Unlike previous work, our approach works even with heavy obfuscation, an advantage we attribute to increased diversity of our training data and increased capacity of our ensemble model.'),
+('aisc2022.pdf', 'Data Augmentation for Code Analysis', '2022-09-01',
+ 'A key challenge of applying machine learning techniques to binary data is the lack of a large corpus of labeled training data. One solution to the lack of real-world data is to create synthetic data from real data through augmentation. In this paper, we demonstrate data augmentation techniques suitable for source code and compiled binary data. By augmenting existing data with semantically-similar sources, training set size is increased, and machine learning models better generalize to unseen data.'),
+('inlocus.pdf', 'Data Distillation at the Network''s Edge: Exposing Programmable Logic with InLocus', '2018-07-01',
+ 'With proliferating sensor networks and Internet of Things-scale devices, networks are increasingly diverse and heterogeneous. To enable the most efficient use of network bandwidth with the lowest possible latency, we propose InLocus, a stream-oriented architecture situated at (or near) the network''s edge which balances hardware-accelerated performance with the flexibility of asynchronous software-based control. In this paper we utilize a flexible platform (Xilinx Zynq SoC) to compare microbenchmarks of several InLocus implementations: naive JavaScript, Handwritten C, and High-Level Synthesis (HLS) in programmable hardware.'),
+('offloading.pdf', 'Offloading Collective Operations to Programmable Logic', '2017-09-01',
+ 'In this article, the authors present a framework for offloading collective operations to programmable logic for use in applications using the Message Passing Interface (MPI). They evaluate their approach on the Xilinx Zynq system on a chip and the NetFPGA, a network interface card based on a field-programmable gate array. Results are presented from microbenchmarks and a benchmark scientific application.');
 
 -- INSERT INTO posts (author_id, created_at, link, title, summary, content) VALUES
 -- (1, '2024-03-10 04:30:00', 'first-post', 'first post', 'some content', 'this is some content'),
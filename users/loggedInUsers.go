@@ -31,6 +31,25 @@ func Exists(pool *pgxpool.Pool, name string) (bool, error) {
 	return exists, err
 }
 
+// NameTaken is Exists ignoring case, so a guest can't go by "Alex_Shroyer"
+// when alex_shroyer is a registered user.
+func NameTaken(pool *pgxpool.Pool, name string) (bool, error) {
+	taken := false
+	query := `SELECT EXISTS(SELECT 1 FROM users WHERE lower(username) = lower($1))`
+	err := pool.QueryRow(context.Background(), query, name).Scan(&taken)
+	return taken, err
+}
+
+func Get(pool *pgxpool.Pool, name string) (User, error) {
+	query := `SELECT username, email, password_hash, created_at FROM users WHERE username = $1`
+	rows, err := pool.Query(context.Background(), query, name)
+	if err != nil {
+		return User{}, err
+	}
+	defer rows.Close()
+	return pgx.CollectOneRow(rows, pgx.RowToStructByName[User])
+}
+
 func CheckPW(pool *pgxpool.Pool, name, password string) (bool, error) {
 	query := `SELECT username, email, password_hash, created_at FROM users WHERE username = $1`
 	rows, err := pool.Query(context.Background(), query, name)
@@ -49,3 +68,10 @@ func Create(pool *pgxpool.Pool, name string, pw string) (User, error) {
 	// query := `INSERT .. INTO users`
 	return User{}, nil
 }
+
+func IsAdmin(pool *pgxpool.Pool, name string) (bool, error) {
+	admin := false
+	query := `SELECT EXISTS(SELECT 1 FROM users WHERE username = $1 AND is_admin)`
+	err := pool.QueryRow(context.Background(), query, name).Scan(&admin)
+	return admin, err
+}
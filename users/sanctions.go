@@ -0,0 +1,78 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// kinds of sanction, from mildest to harshest
+const (
+	Mute      = "mute"      // can read and log in, but not comment
+	Shadowban = "shadowban" // comments are only visible to their author
+	Ban       = "ban"       // can't log in
+)
+
+type Sanction struct {
+	Username string     `db:"username"`
+	Kind     string     `db:"kind"`
+	Reason   string     `db:"reason"`
+	Expires  *time.Time `db:"expires_at"` // nil means permanent
+}
+
+func ValidSanction(kind string) bool {
+	return kind == Mute || kind == Shadowban || kind == Ban
+}
+
+// Sanctioned reports whether name is currently under a sanction of the given kind.
+func Sanctioned(pool *pgxpool.Pool, name, kind string) (bool, error) {
+	sanctioned := false
+	query := `
+SELECT EXISTS(SELECT 1 FROM sanctions s JOIN users u ON s.user_id = u.id
+WHERE u.username = $1 AND s.kind = $2 AND (s.expires_at IS NULL OR s.expires_at > now()))`
+	err := pool.QueryRow(context.Background(), query, name, kind).Scan(&sanctioned)
+	return sanctioned, err
+}
+
+// AddSanction applies a sanction for duration d, or forever if d is zero.
+func AddSanction(pool *pgxpool.Pool, name, kind, reason string, d time.Duration) error {
+	if !ValidSanction(kind) {
+		return errors.New("unknown sanction " + kind)
+	}
+	var expires *time.Time
+	if d > 0 {
+		t := time.Now().Add(d)
+		expires = &t
+	}
+	query := `
+INSERT INTO sanctions (user_id, kind, reason, expires_at)
+VALUES ((SELECT id FROM users WHERE username = $1), $2, $3, $4)`
+	_, err := pool.Exec(context.Background(), query, name, kind, reason, expires)
+	return err
+}
+
+// LiftSanctions ends every active sanction on name.
+func LiftSanctions(pool *pgxpool.Pool, name string) error {
+	query := `
+UPDATE sanctions SET expires_at = now()
+WHERE user_id = (SELECT id FROM users WHERE username = $1) AND (expires_at IS NULL OR expires_at > now())`
+	_, err := pool.Exec(context.Background(), query, name)
+	return err
+}
+
+func ActiveSanctions(pool *pgxpool.Pool) ([]Sanction, error) {
+	query := `
+SELECT u.username, s.kind, s.reason, s.expires_at
+FROM sanctions s JOIN users u ON s.user_id = u.id
+WHERE s.expires_at IS NULL OR s.expires_at > now()
+ORDER BY s.created_at DESC`
+	rows, err := pool.Query(context.Background(), query)
+	if err != nil {
+		return []Sanction{}, err
+	}
+	defer rows.Close()
+	return pgx.CollectRows(rows, pgx.RowToStructByName[Sanction])
+}
@@ -0,0 +1,52 @@
+package webmention
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// Client does the HTTP side of sending and verifying webmentions.
+type Client struct {
+	HTTP    *http.Client
+	MaxBody int64 // stop reading documents after this many bytes
+}
+
+var errPrivateAddr = errors.New("webmention: refusing to connect to a private address")
+
+// NewClient returns a Client that won't connect to loopback or private
+// networks, since source URLs come from strangers on the internet.
+func NewClient() *Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+				ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+				return errPrivateAddr
+			}
+			return nil
+		},
+	}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, addr)
+		},
+		TLSHandshakeTimeout:   5 * time.Second,
+		ResponseHeaderTimeout: 10 * time.Second,
+	}
+	return &Client{
+		HTTP: &http.Client{
+			Transport: transport,
+			Timeout:   15 * time.Second,
+		},
+		MaxBody: 1 << 20,
+	}
+}
@@ -0,0 +1,153 @@
+package webmention
+
+import (
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+var ErrNoEndpoint = errors.New("webmention: no endpoint found")
+
+// Discover finds target's webmention endpoint, checking the Link header first
+// and then <link> and <a> elements, as the spec requires.
+func (c *Client) Discover(target string) (string, error) {
+	resp, err := c.HTTP.Get(target)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	base := resp.Request.URL // after redirects
+
+	for _, header := range resp.Header.Values("Link") {
+		if href, ok := linkHeaderEndpoint(header); ok {
+			return resolve(base, href)
+		}
+	}
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		return "", ErrNoEndpoint
+	}
+	doc, err := html.Parse(io.LimitReader(resp.Body, c.MaxBody))
+	if err != nil {
+		return "", err
+	}
+	if href, ok := findEndpoint(doc); ok {
+		return resolve(base, href)
+	}
+	return "", ErrNoEndpoint
+}
+
+// linkHeaderEndpoint picks the rel="webmention" entry out of a header like
+// `<https://example.com/wm>; rel="webmention", <...>; rel="other"`.
+func linkHeaderEndpoint(header string) (string, bool) {
+	for _, link := range strings.Split(header, ",") {
+		parts := strings.Split(link, ";")
+		href := strings.TrimSpace(parts[0])
+		if !strings.HasPrefix(href, "<") || !strings.HasSuffix(href, ">") {
+			continue
+		}
+		for _, param := range parts[1:] {
+			key, val, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(key, "rel") && hasRel(strings.Trim(val, `"`)) {
+				return href[1 : len(href)-1], true
+			}
+		}
+	}
+	return "", false
+}
+
+func findEndpoint(n *html.Node) (string, bool) {
+	if n.Type == html.ElementNode && (n.Data == "link" || n.Data == "a") {
+		href, hasHref := attr(n, "href")
+		if rel, _ := attr(n, "rel"); hasHref && hasRel(rel) {
+			return href, true
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if href, ok := findEndpoint(c); ok {
+			return href, true
+		}
+	}
+	return "", false
+}
+
+func hasRel(rel string) bool {
+	for _, r := range strings.Fields(rel) {
+		if strings.EqualFold(r, "webmention") {
+			return true
+		}
+	}
+	return false
+}
+
+// an empty href is valid and means the page itself
+func resolve(base *url.URL, href string) (string, error) {
+	u, err := base.Parse(href)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+// Send notifies target's endpoint that source links to it.
+func (c *Client) Send(source, target string) error {
+	endpoint, err := c.Discover(target)
+	if err != nil {
+		return err
+	}
+	resp, err := c.HTTP.PostForm(endpoint, url.Values{"source": {source}, "target": {target}})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.New("webmention: endpoint returned " + resp.Status)
+	}
+	return nil
+}
+
+// Links returns the absolute http(s) URLs of every <a href> in an HTML document.
+func Links(r io.Reader, base *url.URL) ([]string, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	var links []string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "a" {
+			if href, ok := attr(n, "href"); ok {
+				if u, err := base.Parse(href); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+					u.Fragment = ""
+					if s := u.String(); !seen[s] {
+						seen[s] = true
+						links = append(links, s)
+					}
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return links, nil
+}
+
+func attr(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// ValidURL accepts only absolute http(s) URLs.
+func ValidURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -0,0 +1,201 @@
+package webmention
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+var (
+	ErrNoLink = errors.New("webmention: source does not link to target")
+	ErrGone   = errors.New("webmention: source is gone")
+)
+
+// Mention is what we keep from a verified source document.
+type Mention struct {
+	Source     string
+	URL        string // the h-entry's u-url, or the source
+	AuthorName string
+	AuthorURL  string
+	Content    string
+	Published  string // as written in the source, e.g. dt-published
+}
+
+// Verify fetches source and checks that it really links to target.
+// If it does, the first h-entry (if any) supplies the author and content.
+// ErrGone means the source was deleted, so any stored mention should go too.
+func (c *Client) Verify(source, target string) (Mention, error) {
+	m := Mention{Source: source, URL: source}
+	resp, err := c.HTTP.Get(source)
+	if err != nil {
+		return m, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusGone || resp.StatusCode == http.StatusNotFound {
+		return m, ErrGone
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return m, fmt.Errorf("webmention: fetching source returned %s", resp.Status)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "" && !strings.HasPrefix(ct, "text/html") {
+		return m, fmt.Errorf("webmention: can't verify source of type %q", ct)
+	}
+	base := resp.Request.URL
+	doc, err := html.Parse(io.LimitReader(resp.Body, c.MaxBody))
+	if err != nil {
+		return m, err
+	}
+	if !linksTo(doc, base, target) {
+		return m, ErrNoLink
+	}
+	if entry := findClass(doc, "h-entry"); entry != nil {
+		parseEntry(entry, base, &m)
+	} else if title := findElement(doc, "title"); title != nil {
+		m.Content = text(title)
+	}
+	return m, nil
+}
+
+func linksTo(n *html.Node, base *url.URL, target string) bool {
+	if n.Type == html.ElementNode && (n.Data == "a" || n.Data == "link" || n.Data == "img" || n.Data == "video" || n.Data == "audio") {
+		key := "href"
+		if n.Data == "img" || n.Data == "video" || n.Data == "audio" {
+			key = "src"
+		}
+		if v, ok := attr(n, key); ok {
+			if u, err := base.Parse(v); err == nil && sameURL(u.String(), target) {
+				return true
+			}
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if linksTo(c, base, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// treat "https://x/posts/a" and "https://x/posts/a/" (or with a #fragment) as the same
+func sameURL(a, b string) bool {
+	norm := func(s string) string {
+		s, _, _ = strings.Cut(s, "#")
+		return strings.TrimSuffix(s, "/")
+	}
+	return norm(a) == norm(b)
+}
+
+// parseEntry reads the handful of microformats2 properties we display.
+func parseEntry(entry *html.Node, base *url.URL, m *Mention) {
+	if author := findClass(entry, "p-author"); author != nil {
+		if hasClass(author, "h-card") {
+			if name := findClass(author, "p-name"); name != nil {
+				m.AuthorName = text(name)
+			} else {
+				m.AuthorName = text(author)
+			}
+			if u := findClass(author, "u-url"); u != nil {
+				m.AuthorURL = urlValue(u, base)
+			} else if author.Data == "a" {
+				m.AuthorURL = urlValue(author, base)
+			}
+		} else {
+			m.AuthorName = text(author)
+			if author.Data == "a" {
+				m.AuthorURL = urlValue(author, base)
+			}
+		}
+	}
+	for _, class := range []string{"e-content", "p-content", "p-summary", "p-name"} {
+		if n := findClass(entry, class); n != nil {
+			m.Content = text(n)
+			break
+		}
+	}
+	if u := findClass(entry, "u-url"); u != nil {
+		if v := urlValue(u, base); v != "" {
+			m.URL = v
+		}
+	}
+	if dt := findClass(entry, "dt-published"); dt != nil {
+		if v, ok := attr(dt, "datetime"); ok {
+			m.Published = v
+		} else {
+			m.Published = text(dt)
+		}
+	}
+}
+
+func urlValue(n *html.Node, base *url.URL) string {
+	key := "href"
+	if n.Data == "img" {
+		key = "src"
+	}
+	v, ok := attr(n, key)
+	if !ok {
+		return text(n)
+	}
+	u, err := base.Parse(v)
+	if err != nil {
+		return ""
+	}
+	return u.String()
+}
+
+func hasClass(n *html.Node, class string) bool {
+	v, _ := attr(n, "class")
+	for _, c := range strings.Fields(v) {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+func findClass(n *html.Node, class string) *html.Node {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && hasClass(c, class) {
+			return c
+		}
+		if found := findClass(c, class); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func findElement(n *html.Node, tag string) *html.Node {
+	if n.Type == html.ElementNode && n.Data == tag {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, tag); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// text flattens a node's text with whitespace collapsed.
+func text(n *html.Node) string {
+	var buf strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			buf.WriteString(n.Data)
+		}
+		if n.Type == html.ElementNode && (n.Data == "script" || n.Data == "style") {
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(buf.String()), " ")
+}
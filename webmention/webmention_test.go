@@ -0,0 +1,249 @@
+package webmention
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// newTestClient talks to local stand-in servers, which NewClient refuses to.
+func newTestClient(srv *httptest.Server) *Client {
+	return &Client{HTTP: srv.Client(), MaxBody: 1 << 20}
+}
+
+// serveHTML answers every request with page, after setting headers.
+func serveHTML(page string, headers map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for k, v := range headers {
+			w.Header().Add(k, v)
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, page)
+	}))
+}
+
+const target = "https://alexshroyer.com/posts/floatver"
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name string
+		page string
+		err  error
+		want Mention
+	}{
+		{
+			name: "plain link",
+			page: `<title>Versioning</title><p>See <a href="` + target + `">this</a>.</p>`,
+			want: Mention{Content: "Versioning"},
+		},
+		{
+			name: "trailing slash and fragment",
+			page: `<a href="` + target + `/#comments">comments</a>`,
+		},
+		{
+			name: "h-entry",
+			page: `<article class="h-entry">
+  <a class="p-author h-card" href="/me"><span class="p-name">Andrew</span></a>
+  <time class="dt-published" datetime="2024-07-03">July 3</time>
+  <div class="e-content">Merged <a href="` + target + `">FloatVer</a>.</div>
+  <a class="u-url" href="/notes/1">permalink</a>
+</article>`,
+			want: Mention{AuthorName: "Andrew", Content: "Merged FloatVer.", Published: "2024-07-03"},
+		},
+		{
+			name: "no link",
+			page: `<p>Nothing to see at <a href="https://alexshroyer.com/posts/other">another post</a>.</p>`,
+			err:  ErrNoLink,
+		},
+		{
+			name: "target only in text",
+			page: `<p>` + target + `</p>`,
+			err:  ErrNoLink,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := serveHTML(tt.page, nil)
+			defer srv.Close()
+			source := srv.URL + "/source"
+			m, err := newTestClient(srv).Verify(source, target)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Verify error = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if m.Source != source {
+				t.Errorf("Source = %q, want %q", m.Source, source)
+			}
+			if m.AuthorName != tt.want.AuthorName || m.Content != tt.want.Content || m.Published != tt.want.Published {
+				t.Errorf("Verify = %+v, want %+v", m, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyHEntryURLs(t *testing.T) {
+	srv := serveHTML(`<div class="h-entry">
+  <a class="p-author h-card" href="/me">Andrew</a>
+  <a class="u-url" href="/notes/1">#</a>
+  <p class="p-content"><a href="`+target+`">link</a></p>
+</div>`, nil)
+	defer srv.Close()
+	m, err := newTestClient(srv).Verify(srv.URL+"/source", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.URL != srv.URL+"/notes/1" {
+		t.Errorf("URL = %q, want the h-entry's u-url", m.URL)
+	}
+	if m.AuthorURL != srv.URL+"/me" {
+		t.Errorf("AuthorURL = %q, want %q", m.AuthorURL, srv.URL+"/me")
+	}
+}
+
+func TestVerifyStatus(t *testing.T) {
+	tests := []struct {
+		status int
+		err    error
+	}{
+		{http.StatusGone, ErrGone},
+		{http.StatusNotFound, ErrGone},
+	}
+	for _, tt := range tests {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.status)
+		}))
+		_, err := newTestClient(srv).Verify(srv.URL, target)
+		srv.Close()
+		if !errors.Is(err, tt.err) {
+			t.Errorf("status %d: error = %v, want %v", tt.status, err, tt.err)
+		}
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+	if _, err := newTestClient(srv).Verify(srv.URL, target); err == nil || errors.Is(err, ErrGone) {
+		t.Errorf("status 500: error = %v, want a temporary failure", err)
+	}
+}
+
+func TestVerifyNotHTML(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"url": %q}`, target)
+	}))
+	defer srv.Close()
+	if _, err := newTestClient(srv).Verify(srv.URL, target); err == nil {
+		t.Error("Verify accepted a JSON source")
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		page    string
+		want    string // relative to the server
+		err     error
+	}{
+		{
+			name:    "link header",
+			headers: map[string]string{"Link": `</wm/header>; rel="webmention"`},
+			page:    `<link rel="webmention" href="/wm/link">`,
+			want:    "/wm/header",
+		},
+		{
+			name:    "link header among others",
+			headers: map[string]string{"Link": `</style.css>; rel="stylesheet", </wm/header>; rel="other webmention"`},
+			want:    "/wm/header",
+		},
+		{
+			name: "link element",
+			page: `<html><head><link rel="webmention" href="/wm/link"></head><body><a rel="webmention" href="/wm/a">x</a></body></html>`,
+			want: "/wm/link",
+		},
+		{
+			name: "a element",
+			page: `<p><a href="/elsewhere">x</a> <a rel="nofollow webmention" href="/wm/a">x</a></p>`,
+			want: "/wm/a",
+		},
+		{
+			name: "relative to the page",
+			page: `<link rel="webmention" href="wm">`,
+			want: "/posts/wm",
+		},
+		{
+			name: "empty href is the page itself",
+			page: `<link rel="webmention" href="">`,
+			want: "/posts/page",
+		},
+		{
+			name: "none",
+			page: `<link rel="stylesheet" href="/style.css">`,
+			err:  ErrNoEndpoint,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := serveHTML(tt.page, tt.headers)
+			defer srv.Close()
+			got, err := newTestClient(srv).Discover(srv.URL + "/posts/page")
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Discover error = %v, want %v", err, tt.err)
+			}
+			if err == nil && got != srv.URL+tt.want {
+				t.Errorf("Discover = %q, want %q", got, srv.URL+tt.want)
+			}
+		})
+	}
+}
+
+func TestSend(t *testing.T) {
+	var mu sync.Mutex
+	var got []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /post", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<link rel="webmention" href="/webmention">`)
+	})
+	mux.HandleFunc("POST /webmention", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		got = append(got, r.PostFormValue("source"), r.PostFormValue("target"))
+		mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	})
+	mux.HandleFunc("GET /broken", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", `</refuse>; rel="webmention"`)
+	})
+	mux.HandleFunc("POST /refuse", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no", http.StatusBadRequest)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	c := newTestClient(srv)
+
+	source := "https://alexshroyer.com/posts/a"
+	if err := c.Send(source, srv.URL+"/post"); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0] != source || got[1] != srv.URL+"/post" {
+		t.Errorf("endpoint got source, target = %q", got)
+	}
+	if err := c.Send(source, srv.URL+"/broken"); err == nil {
+		t.Error("Send ignored a 400 from the endpoint")
+	}
+}
+
+func TestNewClientRefusesLoopback(t *testing.T) {
+	srv := serveHTML(`<a href="`+target+`">x</a>`, nil)
+	defer srv.Close()
+	if _, err := NewClient().Verify(srv.URL, target); !errors.Is(err, errPrivateAddr) {
+		t.Errorf("Verify of a loopback source: error = %v, want %v", err, errPrivateAddr)
+	}
+}